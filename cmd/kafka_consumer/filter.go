@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// A Filter matches messages by a regular expression, like grep. If Field is
+// set, the expression is matched against the field of the message, see
+// Message.Field, otherwise against the whole value.
+type Filter struct {
+	Field   string
+	Negate  bool
+	Pattern *regexp.Regexp
+}
+
+var filterSyntax = regexp.MustCompile(`^([@\w.-]+)(!?=)(.*)$`)
+
+// ParseFilter parses a filter of the form '<field>=<regexp>',
+// '<field>!=<regexp>' or '<regexp>'.
+func ParseFilter(s string) (Filter, error) {
+	var f Filter
+	expr := s
+	if m := filterSyntax.FindStringSubmatch(s); m != nil {
+		f.Field, f.Negate, expr = m[1], m[2] == "!=", m[3]
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return f, fmt.Errorf("invalid filter '%v': %w", s, err)
+	}
+	f.Pattern = pattern
+	return f, nil
+}
+
+func (f Filter) String() string {
+	switch {
+	case f.Field == "":
+		return f.Pattern.String()
+	case f.Negate:
+		return fmt.Sprintf("%v!=%v", f.Field, f.Pattern)
+	}
+	return fmt.Sprintf("%v=%v", f.Field, f.Pattern)
+}
+
+// Match reports whether the filter matches the message. A negated filter
+// matches if the field is missing.
+func (f Filter) Match(m *Message) bool {
+	if f.Field == "" {
+		return f.Pattern.MatchString(m.Text())
+	}
+	v, ok := m.Field(f.Field)
+	if !ok {
+		return f.Negate
+	}
+	return f.Pattern.MatchString(v) != f.Negate
+}
+
+// Match reports whether all filters match the message.
+func Match(filters []Filter, m *Message) bool {
+	for _, f := range filters {
+		if !f.Match(m) {
+			return false
+		}
+	}
+	return true
+}
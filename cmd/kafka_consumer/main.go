@@ -1,31 +1,282 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/kafkaclient"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/output"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
 	"github.com/dateiexplorer/dhbw-vslab-applications/internal/wrapper"
+	"github.com/google/uuid"
 )
 
 const (
-	Broker = "10.50.15.52"
+	Broker  = "10.50.15.52"
+	Timeout = 5 * time.Second
 )
 
 var (
-	topic = "weather"
+	broker      string
+	kafkaConfig *kafkaclient.Config
+	topic       string
+	partitions  []int32
+	offset      kafka.Offset
+	since       time.Time
+	count       int
+	decoder     Decoder
+	filters     []Filter
+	invert      bool
+	printer     *Printer
 )
 
-func printWeatherData(w *data.WeatherData) {
-	fmt.Println(w)
+// filterFlags collects the values of the repeatable '-grep' flag.
+type filterFlags []Filter
+
+func (f *filterFlags) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *filterFlags) Set(s string) error {
+	filter, err := ParseFilter(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, filter)
+	return nil
+}
+
+// parseOffset parses the start offset, which is 'beginning', 'end', an
+// absolute offset or a negative offset relative to the end.
+func parseOffset(s string) (kafka.Offset, error) {
+	switch s {
+	case "beginning":
+		return kafka.OffsetBeginning, nil
+	case "end":
+		return kafka.OffsetEnd, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset '%v'", s)
+	}
+	if n < 0 {
+		return kafka.OffsetTail(kafka.Offset(-n)), nil
+	}
+	return kafka.Offset(n), nil
+}
+
+// parseSince parses the start time, which is a timestamp or a duration
+// before now, e.g. '10m'.
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return data.ParseTimestamp(s)
+}
+
+// parsePartitions parses a comma separated list of partitions.
+func parsePartitions(s string) ([]int32, error) {
+	var partitions []int32
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(p, 10, 32)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid partition '%v'", p)
+		}
+		partitions = append(partitions, int32(n))
+	}
+	return partitions, nil
+}
+
+// init initializes all neccessary global variables, e.g. from the command line
+// interface.
+func init() {
+	var partitionList, offsetValue, sinceValue, decode string
+	var showKey, showHeaders, payloadTime bool
+	var grep filterFlags
+	flag.StringVar(&broker, "broker", Broker, "Kafka bootstrap servers.")
+	flag.StringVar(&topic, "t", "weather", "Topic to consume.")
+	flag.StringVar(&partitionList, "p", "",
+		"Comma separated list of partitions to consume. All partitions if empty.")
+	flag.StringVar(&offsetValue, "offset", "end",
+		"Offset to start from, 'beginning', 'end', an offset or a negative offset relative to the end.")
+	flag.StringVar(&sinceValue, "since", "",
+		"Start at the first message at or after this timestamp, or this duration ago, e.g. '10m', or at the beginning if '0'. Overrides -offset.")
+	flag.IntVar(&count, "n", 0, "Stop after this number of messages. Unlimited if 0.")
+	flag.BoolVar(&showKey, "keys", false, "Show the key of each message.")
+	flag.BoolVar(&showHeaders, "headers", false, "Show the headers of each message.")
+	flag.BoolVar(&payloadTime, "payload-time", false,
+		"Show the timestamp of the weather data payload instead of the timestamp of the message.")
+	flag.StringVar(&decode, "decode", "weather",
+		"How to decode the values, 'weather', 'tankerkoenig', 'json' or 'raw'.")
+	flag.Var(&grep, "grep",
+		"Only show messages matching '<field>=<regexp>', '<field>!=<regexp>' or '<regexp>'. Can be repeated.")
+	flag.BoolVar(&invert, "invert", false, "Only show messages not matching the -grep filters.")
+	outputConfig := output.RegisterFlags()
+	registryLocation := schema.RegisterFlag()
+	kafkaConfig = kafkaclient.RegisterFlags()
+	logConfig := logging.RegisterFlags("warn")
+	flag.Parse()
+	logConfig.Setup("kafka_consumer")
+
+	var errs []error
+	var err error
+	if err = kafkaConfig.Load(); err != nil {
+		errs = append(errs, err)
+	}
+	if partitions, err = parsePartitions(partitionList); err != nil {
+		errs = append(errs, err)
+	}
+	if offset, err = parseOffset(offsetValue); err != nil {
+		errs = append(errs, err)
+	}
+	switch sinceValue {
+	case "":
+	case "0":
+		// Not a duration of zero, which would be now.
+		offset = kafka.OffsetBeginning
+	default:
+		if since, err = parseSince(sinceValue); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if count < 0 {
+		errs = append(errs, errors.New("the number of messages must not be negative"))
+	}
+	registry, err := schema.Open(*registryLocation)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("cannot open schema registry: %w", err))
+	}
+	if decoder, err = NewDecoder(decode, registry, payloadTime); err != nil {
+		errs = append(errs, err)
+	}
+	if printer, err = NewPrinter(outputConfig, decode, showKey, showHeaders); err != nil {
+		errs = append(errs, err)
+	}
+	filters = grep
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "ERROR: %v.\n", err)
+		}
+		flag.Usage()
+		os.Exit(1)
+	}
+}
+
+// assignment returns the partitions to consume with their start offsets.
+func assignment(c *kafka.Consumer) ([]kafka.TopicPartition, error) {
+	timeoutMs := int(Timeout.Milliseconds())
+	metadata, err := c.GetMetadata(&topic, false, timeoutMs)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get metadata for topic '%v': %w", topic, err)
+	}
+	topicMetadata := metadata.Topics[topic]
+	if topicMetadata.Error.Code() != kafka.ErrNoError {
+		return nil, fmt.Errorf("cannot get metadata for topic '%v': %w", topic, topicMetadata.Error)
+	}
+
+	available := map[int32]bool{}
+	for _, p := range topicMetadata.Partitions {
+		available[p.ID] = true
+	}
+	ids := partitions
+	if len(ids) == 0 {
+		for _, p := range topicMetadata.Partitions {
+			ids = append(ids, p.ID)
+		}
+	}
+
+	assigned := make([]kafka.TopicPartition, 0, len(ids))
+	for _, id := range ids {
+		if !available[id] {
+			return nil, fmt.Errorf("topic '%v' has no partition %v", topic, id)
+		}
+		tp := kafka.TopicPartition{Topic: &topic, Partition: id, Offset: offset}
+		if !since.IsZero() {
+			// OffsetsForTimes expects the timestamp in the offset field.
+			tp.Offset = kafka.Offset(since.UnixMilli())
+		}
+		assigned = append(assigned, tp)
+	}
+
+	if !since.IsZero() {
+		if assigned, err = c.OffsetsForTimes(assigned, timeoutMs); err != nil {
+			return nil, fmt.Errorf("cannot get offsets for timestamp %v: %w", since, err)
+		}
+	}
+	return assigned, nil
 }
 
 func main() {
+	c, err := kafkaConfig.NewConsumer(broker, kafka.ConfigMap{
+		// The partitions are assigned manually and no offsets are committed,
+		// so other consumers aren't affected. A 'group.id' is neccessary
+		// anyway.
+		"group.id":           fmt.Sprintf("kafka_consumer-%v", uuid.NewString()),
+		"enable.auto.commit": false,
+	})
+	if err != nil {
+		logging.Fatal("failed to create consumer", "broker", broker, "err", err)
+	}
+	defer c.Close()
+
+	assigned, err := assignment(c)
+	if err != nil {
+		logging.Fatal("cannot assign partitions", "broker", broker, "err", err)
+	}
+	if err := c.Assign(assigned); err != nil {
+		logging.Fatal("cannot assign partitions", "broker", broker, "err", err)
+	}
+	logger := slog.With("broker", broker, "topic", topic)
+	logger.Info("partitions assigned, waiting for messages", "partitions", len(assigned))
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
-	// This wrapper blocks the main thread until a signal is received.
-	wrapper.RunKafkaWeatherDataConsumer(Broker, topic, stop, printWeatherData)
+	shown := 0
+	for count == 0 || shown < count {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		msg, err := c.ReadMessage(100 * time.Millisecond)
+		if err != nil {
+			// Ignore the timout error.
+			if err.(kafka.Error).Code() == kafka.ErrTimedOut {
+				continue
+			}
+			// The client will automatically try to recover from all errors.
+			logger.Error("consumer error", "err", err)
+			continue
+		}
+
+		m, err := decoder(msg)
+		if err != nil {
+			wrapper.MessageLogger(logger, msg).Warn("cannot decode message",
+				"value", string(msg.Value), "err", err)
+			continue
+		}
+		if Match(filters, m) == invert {
+			continue
+		}
+		if err := printer.Print(m); err != nil {
+			logging.Fatal("cannot print message", "err", err)
+		}
+		shown++
+	}
 }
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/output"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/wrapper"
+)
+
+// A Message is a consumed Kafka message with its decoded value.
+type Message struct {
+	Topic     string            `json:"topic"`
+	Partition int32             `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Timestamp time.Time         `json:"timestamp"`
+	Key       string            `json:"key,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	// Value is the decoded value, either a *data.WeatherData, a
+	// *data.TankerkoenigEntry, a JSON value or the raw value as string.
+	Value any `json:"value"`
+
+	fields map[string]string
+}
+
+// A Decoder decodes a Kafka message.
+type Decoder func(msg *kafka.Message) (*Message, error)
+
+// NewDecoder returns the decoder for the values of kind, which is 'weather',
+// 'tankerkoenig', 'json' or 'raw'. The registry r resolves the schemas of
+// framed payloads and may be nil. The timestamp of weather data is replaced
+// by the timestamp of the message, unless payloadTime is set.
+func NewDecoder(kind string, r schema.Registry, payloadTime bool) (Decoder, error) {
+	var decodeValue func(msg *kafka.Message) (any, error)
+	switch kind {
+	case "weather":
+		decodeValue = func(msg *kafka.Message) (any, error) {
+			format, err := wrapper.PayloadFormat(msg)
+			if err != nil {
+				return nil, err
+			}
+			w, err := format.DecodeWeatherData(r, msg.Value)
+			if err != nil {
+				return nil, err
+			}
+			// The timestamps of the payloads aren't continuous, e.g. for
+			// simulated data, so the time the message was produced is
+			// shown by default.
+			if !payloadTime && msg.TimestampType != kafka.TimestampNotAvailable {
+				w.TimeStamp = msg.Timestamp
+			}
+			return w, nil
+		}
+	case "tankerkoenig":
+		decodeValue = func(msg *kafka.Message) (any, error) {
+			return data.DecodeTankerkoenigEntry(r, msg.Value)
+		}
+	case "json":
+		decodeValue = func(msg *kafka.Message) (any, error) {
+			dec := json.NewDecoder(bytes.NewReader(msg.Value))
+			dec.UseNumber()
+			var v any
+			err := dec.Decode(&v)
+			return v, err
+		}
+	case "raw":
+		decodeValue = func(msg *kafka.Message) (any, error) {
+			return string(msg.Value), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown decoder '%v'", kind)
+	}
+
+	return func(msg *kafka.Message) (*Message, error) {
+		value, err := decodeValue(msg)
+		if err != nil {
+			return nil, err
+		}
+		m := &Message{
+			Partition: msg.TopicPartition.Partition,
+			Offset:    int64(msg.TopicPartition.Offset),
+			Timestamp: msg.Timestamp,
+			Key:       string(msg.Key),
+			Value:     value,
+		}
+		if msg.TopicPartition.Topic != nil {
+			m.Topic = *msg.TopicPartition.Topic
+		}
+		if len(msg.Headers) > 0 {
+			m.Headers = map[string]string{}
+			for _, h := range msg.Headers {
+				m.Headers[h.Key] = string(h.Value)
+			}
+		}
+		return m, nil
+	}, nil
+}
+
+// Text returns the value as text, which is the value itself for raw values
+// and the JSON encoding otherwise.
+func (m *Message) Text() string {
+	if s, ok := m.Value.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(m.Value)
+	return string(b)
+}
+
+// Field returns the value of a field of the message. Fields of the value are
+// addressed by their JSON name, nested fields are separated by dots, e.g.
+// 'city' or 'items.0.name'. The fields '@topic', '@partition', '@offset',
+// '@key' and '@header.<name>' address the message itself.
+func (m *Message) Field(name string) (string, bool) {
+	switch name {
+	case "@topic":
+		return m.Topic, true
+	case "@partition":
+		return fmt.Sprint(m.Partition), true
+	case "@offset":
+		return fmt.Sprint(m.Offset), true
+	case "@key":
+		return m.Key, true
+	}
+	if header, ok := strings.CutPrefix(name, "@header."); ok {
+		v, ok := m.Headers[header]
+		return v, ok
+	}
+
+	if m.fields == nil {
+		m.fields = map[string]string{}
+		if _, raw := m.Value.(string); !raw {
+			dec := json.NewDecoder(strings.NewReader(m.Text()))
+			dec.UseNumber()
+			var v any
+			if err := dec.Decode(&v); err == nil {
+				flatten("", v, m.fields)
+			}
+		}
+	}
+	v, ok := m.fields[name]
+	return v, ok
+}
+
+// flatten adds all leaf values of the JSON value v to fields, with their
+// dotted path as key.
+func flatten(path string, v any, fields map[string]string) {
+	join := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for name, child := range v {
+			flatten(join(name), child, fields)
+		}
+	case []any:
+		for i, child := range v {
+			flatten(join(fmt.Sprint(i)), child, fields)
+		}
+	case nil:
+		fields[path] = "null"
+	default:
+		fields[path] = fmt.Sprint(v)
+	}
+}
+
+// metadata returns a line describing the message, e.g.
+// 'weather/3@10245 key=Mosbach content-type=application/json'.
+func (m *Message) metadata(showKey, showHeaders bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v/%v@%v", m.Topic, m.Partition, m.Offset)
+	if showKey {
+		fmt.Fprintf(&b, " key=%q", m.Key)
+	}
+	if showHeaders {
+		names := make([]string, 0, len(m.Headers))
+		for name := range m.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, " %v=%q", name, m.Headers[name])
+		}
+	}
+	return b.String()
+}
+
+// A Printer prints messages in an output format.
+type Printer struct {
+	out         io.Writer
+	format      string
+	weather     output.Printer
+	showKey     bool
+	showHeaders bool
+}
+
+// NewPrinter creates a printer writing to stdout. Weather data supports all
+// output formats of the output package, other values only 'text', 'line',
+// 'json' and 'ndjson'. If keys or headers are shown, the JSON formats wrap
+// the value in an object with the message metadata.
+func NewPrinter(c *output.Config, decode string, showKey, showHeaders bool) (*Printer, error) {
+	p := &Printer{
+		out:         os.Stdout,
+		format:      strings.ToLower(c.Format),
+		showKey:     showKey,
+		showHeaders: showHeaders,
+	}
+	if p.format == "" {
+		p.format = "text"
+	}
+
+	switch p.format {
+	case "text", "line", "json", "ndjson":
+	default:
+		if decode != "weather" {
+			return nil, fmt.Errorf("the output '%v' is only supported for weather data", c.Format)
+		}
+		if showKey || showHeaders {
+			return nil, fmt.Errorf("keys and headers can't be shown with the output '%v'", c.Format)
+		}
+	}
+
+	if decode == "weather" {
+		weather, err := c.New(p.out)
+		if err != nil {
+			return nil, err
+		}
+		p.weather = weather
+	}
+	return p, nil
+}
+
+func (p *Printer) Print(m *Message) error {
+	meta := p.showKey || p.showHeaders
+	switch p.format {
+	case "json", "ndjson":
+		enc := json.NewEncoder(p.out)
+		if p.format == "json" {
+			enc.SetIndent("", "  ")
+		}
+		if meta {
+			return enc.Encode(m)
+		}
+		return enc.Encode(m.Value)
+	case "text", "line":
+		if meta {
+			sep := "\n"
+			if p.format == "line" {
+				sep = " "
+			}
+			if _, err := fmt.Fprint(p.out, m.metadata(p.showKey, p.showHeaders), sep); err != nil {
+				return err
+			}
+		}
+	}
+
+	if w, ok := m.Value.(*data.WeatherData); ok {
+		return p.weather.Print(w)
+	}
+	var text string
+	switch v := m.Value.(type) {
+	case string:
+		text = v
+	case *data.TankerkoenigEntry:
+		if p.format == "text" {
+			text = v.String()
+		} else {
+			text = m.Text()
+		}
+	default:
+		if p.format == "text" {
+			b, _ := json.MarshalIndent(v, "", "  ")
+			text = string(b)
+		} else {
+			text = m.Text()
+		}
+	}
+	_, err := fmt.Fprintln(p.out, strings.TrimRight(text, "\n"))
+	return err
+}
@@ -1,59 +1,57 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"flag"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
-	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/graphitesink"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/health"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/kafkaclient"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
 	"github.com/dateiexplorer/dhbw-vslab-applications/internal/wrapper"
-	"github.com/jtaczanowski/go-graphite-client"
 )
 
-const (
-	Broker             = "10.50.15.52"
-	GraphiteHost       = "10.50.15.52"
-	GraphitePort       = 2003
-	GraphiteMetricsPfx = "vlvs_inf19b.5703004.weather"
-	GraphiteProtocol   = "tcp"
-)
+const Broker = "10.50.15.52"
 
-var (
-	topic          = "weather"
-	graphiteClient *graphite.Client
-)
+var topic = "weather"
 
-func sendWeatherDataToGraphite(w *data.WeatherData) {
-	// Use the lowercase variant of the city name and replace spaces with
-	// '-'. This is the case e.g. for 'Bad Mergentheim'.
-	city := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(w.City), " ", "-"))
-	var metrics = map[string]float64{
-		fmt.Sprintf("%v.tempCurrent", city): w.TempCurrent,
-		fmt.Sprintf("%v.tempMin", city):     w.TempMin,
-		fmt.Sprintf("%v.tempMax", city):     w.TempMax,
+func main() {
+	var broker, healthAddr string
+	var maxIdle time.Duration
+	flag.StringVar(&broker, "broker", Broker, "Kafka bootstrap servers.")
+	flag.StringVar(&healthAddr, "health-addr", "",
+		"Address to serve /healthz and /readyz on, e.g. ':8080'. Disabled if empty.")
+	flag.DurationVar(&maxIdle, "max-idle", 0,
+		"Report unhealthy if no message was received within this duration. Disabled if 0.")
+	registryLocation := schema.RegisterFlag()
+	kafkaConfig := kafkaclient.RegisterFlags()
+	logConfig := logging.RegisterFlags("info")
+	flag.Parse()
+	logConfig.Setup("kafka_graphite_bridge")
+	kafkaConfig.Setup()
+
+	registry, err := schema.Open(*registryLocation)
+	if err != nil {
+		logging.Fatal("cannot open schema registry", "err", err)
 	}
 
-	// Send data to graphite.
-	timestamp := w.TimeStamp.Unix()
-	if err := graphiteClient.SendDataWithTimeStamp(metrics, timestamp); err != nil {
-		fmt.Fprintf(os.Stderr, "error while sending data to graphite: %v", err)
-	} else {
-		log.Printf("Send data to graphite: %v with timestamp %v (local: %v)\n",
-			metrics, timestamp, time.Unix(timestamp, 0).Local())
-	}
-}
+	sink := graphitesink.New(graphitesink.Host, graphitesink.Port,
+		graphitesink.MetricsPrefix, graphitesink.Protocol)
 
-func main() {
-	graphiteClient = graphite.NewClient(GraphiteHost, GraphitePort,
-		GraphiteMetricsPfx, GraphiteProtocol)
+	monitor := health.NewMonitor()
+	monitor.AddReadinessCheck("graphite", sink.Check)
+	monitor.ListenAndServe(healthAddr)
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
 	// This wrapper blocks the main thread until a signal is received.
-	wrapper.RunKafkaWeatherDataConsumer(Broker, topic, stop, sendWeatherDataToGraphite)
+	wrapper.RunKafkaWeatherDataConsumer(broker, topic, stop,
+		wrapper.ConsumerOptions{Monitor: monitor, MaxIdle: maxIdle, Registry: registry,
+			Kafka: kafkaConfig},
+		sink.Send)
 }
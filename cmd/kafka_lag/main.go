@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/kafkaclient"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/jtaczanowski/go-graphite-client"
+)
+
+const (
+	// Kafka configuration
+	Broker  = "10.50.15.52"
+	Group   = "vlvs_inf19b-5703004-tankerkoenig"
+	Topic   = "tankerkoenig"
+	Timeout = 5 * time.Second
+
+	// Graphite configuration
+	GraphiteHost       = "10.50.15.52"
+	GraphitePort       = 2003
+	GraphiteMetricsPfx = "vlvs_inf19b.5703004.lag"
+	GraphiteProtocol   = "tcp"
+)
+
+var (
+	group          string
+	topics         []string
+	interval       time.Duration
+	format         string
+	graphiteClient *graphite.Client
+	broker         string
+	kafkaConfig    *kafkaclient.Config
+
+	// csvHeaderPrinted is set after the header of the CSV output was
+	// printed, which is printed only once for periodic reports.
+	csvHeaderPrinted bool
+)
+
+// csvHeader are the columns of the CSV output.
+var csvHeader = []string{"time", "group", "topic", "partition", "committed", "high", "lag"}
+
+// A PartitionLag represents the lag of a consumer group on a single
+// partition.
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	Committed kafka.Offset
+	Low       int64
+	High      int64
+}
+
+// Lag returns the number of messages in the partition the consumer group
+// hasn't consumed yet. If the group hasn't committed an offset for this
+// partition, all messages in the partition count as lag.
+func (p PartitionLag) Lag() int64 {
+	if p.Committed < 0 {
+		return p.High - p.Low
+	}
+	lag := p.High - int64(p.Committed)
+	if lag < 0 {
+		return 0
+	}
+	return lag
+}
+
+// queryLag queries the committed offsets of the consumer group and the
+// watermarks of all partitions of the topics.
+func queryLag(c *kafka.Consumer) ([]PartitionLag, error) {
+	timeoutMs := int(Timeout.Milliseconds())
+
+	var partitions []kafka.TopicPartition
+	for i := range topics {
+		topic := topics[i]
+		metadata, err := c.GetMetadata(&topic, false, timeoutMs)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get metadata for topic '%v': %w", topic, err)
+		}
+		topicMetadata := metadata.Topics[topic]
+		if topicMetadata.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("cannot get metadata for topic '%v': %w",
+				topic, topicMetadata.Error)
+		}
+		for _, p := range topicMetadata.Partitions {
+			partitions = append(partitions, kafka.TopicPartition{
+				Topic:     &topic,
+				Partition: p.ID,
+			})
+		}
+	}
+
+	committed, err := c.Committed(partitions, timeoutMs)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get committed offsets for group '%v': %w", group, err)
+	}
+
+	lags := make([]PartitionLag, 0, len(committed))
+	for _, tp := range committed {
+		if tp.Error != nil {
+			return nil, fmt.Errorf("cannot get committed offset for partition %v of topic '%v': %w",
+				tp.Partition, *tp.Topic, tp.Error)
+		}
+		low, high, err := c.QueryWatermarkOffsets(*tp.Topic, tp.Partition, timeoutMs)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get watermarks for partition %v of topic '%v': %w",
+				tp.Partition, *tp.Topic, err)
+		}
+		lags = append(lags, PartitionLag{
+			Topic:     *tp.Topic,
+			Partition: tp.Partition,
+			Committed: tp.Offset,
+			Low:       low,
+			High:      high,
+		})
+	}
+	return lags, nil
+}
+
+// printLag prints the lags in the configured format on stdout.
+func printLag(t time.Time, lags []PartitionLag) {
+	var total int64
+	for _, l := range lags {
+		total += l.Lag()
+	}
+
+	switch format {
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		if !csvHeaderPrinted {
+			w.Write(csvHeader)
+			csvHeaderPrinted = true
+		}
+		for _, l := range lags {
+			w.Write([]string{t.Format(time.RFC3339), group, l.Topic,
+				strconv.Itoa(int(l.Partition)), l.Committed.String(),
+				strconv.FormatInt(l.High, 10), strconv.FormatInt(l.Lag(), 10)})
+		}
+		w.Flush()
+	default:
+		fmt.Printf("Lag of group '%v' at %v:\n", group, t.Format(time.RFC3339))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  TOPIC\tPARTITION\tCOMMITTED\tHIGH\tLAG")
+		for _, l := range lags {
+			fmt.Fprintf(w, "  %v\t%v\t%v\t%v\t%v\n",
+				l.Topic, l.Partition, l.Committed, l.High, l.Lag())
+		}
+		fmt.Fprintf(w, "  TOTAL\t\t\t\t%v\n", total)
+		w.Flush()
+	}
+}
+
+// sanitize makes s usable as a single node of a Graphite metric path.
+func sanitize(s string) string {
+	return strings.NewReplacer(".", "_", " ", "-").Replace(s)
+}
+
+// sendLagToGraphite sends the lag of each partition and the total lag per
+// topic to Graphite.
+func sendLagToGraphite(t time.Time, lags []PartitionLag) {
+	metrics := map[string]float64{}
+	for _, l := range lags {
+		prefix := fmt.Sprintf("%v.%v", sanitize(group), sanitize(l.Topic))
+		metrics[fmt.Sprintf("%v.%v", prefix, l.Partition)] = float64(l.Lag())
+		metrics[fmt.Sprintf("%v.total", prefix)] += float64(l.Lag())
+	}
+
+	if err := graphiteClient.SendDataWithTimeStamp(metrics, t.Unix()); err != nil {
+		slog.Error("error while sending data to graphite", "err", err)
+	} else {
+		slog.Debug("send data to graphite", "metrics", metrics, "timestamp", t.Unix())
+	}
+}
+
+// report queries the lag once and reports it.
+func report(c *kafka.Consumer) error {
+	now := time.Now()
+	lags, err := queryLag(c)
+	if err != nil {
+		slog.Error("cannot query lag", "group", group, "err", err)
+		return err
+	}
+
+	printLag(now, lags)
+	if graphiteClient != nil {
+		sendLagToGraphite(now, lags)
+	}
+	return nil
+}
+
+// init initializes all neccessary global variables, e.g. from the command line
+// interface.
+func init() {
+	var topicList string
+	var useGraphite bool
+	flag.StringVar(&broker, "broker", Broker, "Kafka bootstrap servers.")
+	flag.StringVar(&group, "g", Group, "Consumer group to monitor.")
+	flag.StringVar(&topicList, "t", Topic, "Comma separated list of topics the group consumes.")
+	flag.DurationVar(&interval, "i", 0, "Report the lag periodically with this interval. Report once if 0.")
+	flag.StringVar(&format, "o", "text", "Output format, either 'text' or 'csv'.")
+	flag.BoolVar(&useGraphite, "graphite", false, "Send the lag to Graphite.")
+	kafkaConfig = kafkaclient.RegisterFlags()
+	logConfig := logging.RegisterFlags("warn")
+	flag.Parse()
+	logConfig.Setup("kafka_lag")
+	kafkaConfig.Setup()
+
+	for _, topic := range strings.Split(topicList, ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	var errs []error
+	if group == "" || len(topics) == 0 {
+		errs = append(errs, errors.New("you must specify a group and at least one topic"))
+	}
+	if format != "text" && format != "csv" {
+		errs = append(errs, fmt.Errorf("invalid output format '%v', must be 'text' or 'csv'", format))
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "ERROR: %v.\n", err)
+		}
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if useGraphite {
+		graphiteClient = graphite.NewClient(GraphiteHost, GraphitePort,
+			GraphiteMetricsPfx, GraphiteProtocol)
+	}
+}
+
+func main() {
+	// The consumer never subscribes, so it doesn't join the group and doesn't
+	// affect the partition assignment of the group's members.
+	c, err := kafkaConfig.NewConsumer(broker, kafka.ConfigMap{
+		"group.id":           group,
+		"enable.auto.commit": false,
+	})
+	if err != nil {
+		logging.Fatal("failed to create consumer", "broker", broker, "err", err)
+	}
+	defer c.Close()
+
+	if interval <= 0 {
+		if err := report(c); err != nil {
+			c.Close()
+			os.Exit(1)
+		}
+		return
+	}
+	report(c)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			report(c)
+		}
+	}
+}
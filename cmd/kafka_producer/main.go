@@ -1,15 +1,22 @@
 package main
 
 import (
-	"encoding/json"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
-	"github.com/google/uuid"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/kafkaclient"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/throttle"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/wrapper"
 )
 
 const (
@@ -19,53 +26,260 @@ const (
 var (
 	// Ensure that this topic is unique
 	topic = "vlvs_inf19b_5703004_random"
+
+	broker      string
+	kafkaConfig *kafkaclient.Config
+	rate        float64
+	interval    time.Duration
+	count       int64
+	duration    time.Duration
+	producers   int
+	payloadKind string
+	size        int
+	tmpl        string
+	keyKind     string
+	keySpace    int
+	partitioner string
+
+	acks         string
+	idempotent   bool
+	flushTimeout time.Duration
 )
 
-type Message struct {
-	Value string
+// init initializes all neccessary global variables, e.g. from the command line
+// interface.
+func init() {
+	flag.StringVar(&broker, "broker", Broker, "Kafka bootstrap servers.")
+	flag.StringVar(&topic, "t", topic, "Topic to produce to.")
+	flag.Float64Var(&rate, "rate", 1, "Total number of messages per second. Unlimited if 0.")
+	flag.Int64Var(&count, "n", 0, "Total number of messages to produce. Unlimited if 0.")
+	flag.DurationVar(&duration, "d", 0, "Duration to produce messages for. Unlimited if 0.")
+	flag.IntVar(&producers, "c", 1, "Number of concurrent producers.")
+	flag.StringVar(&payloadKind, "payload", "uuid",
+		"Payload type, one of 'uuid', 'random', 'weather', 'tankerkoenig' or 'template'.")
+	flag.IntVar(&size, "size", 100, "Size of 'random' payloads in bytes.")
+	flag.StringVar(&tmpl, "template", "",
+		"Go template for 'template' payloads, or '@<file>' to read it from a file.")
+	flag.StringVar(&keyKind, "keys", "value",
+		"Key distribution, one of 'value', 'none', 'uuid', 'sequential', 'uniform' or 'zipf'.")
+	flag.IntVar(&keySpace, "key-space", 100, "Number of distinct keys for 'uniform' and 'zipf' keys.")
+	flag.StringVar(&partitioner, "partitioner", "",
+		"librdkafka partitioner, e.g. 'random', 'consistent_random' or 'murmur2'.")
+	flag.StringVar(&acks, "acks", "",
+		"Required acknowledgements, one of '0', '1' or 'all'. Uses the librdkafka default if empty.")
+	flag.BoolVar(&idempotent, "idempotent", false,
+		"Enable the idempotent producer, which implies '-acks all'.")
+	flag.DurationVar(&flushTimeout, "flush-timeout", 10*time.Second,
+		"Maximum time to wait for outstanding delivery reports on exit.")
+	kafkaConfig = kafkaclient.RegisterFlags()
+	logConfig := logging.RegisterFlags("info")
+	flag.Parse()
+	logConfig.Setup("kafka_producer")
+	kafkaConfig.Setup()
+
+	if producers < 1 || rate < 0 || count < 0 || duration < 0 || flushTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: rate, count, durations and producers must not be negative.")
+		flag.Usage()
+		os.Exit(1)
+	}
+	// Each producer produces an equal share of the total rate. A rate of 0
+	// is unlimited.
+	if rate != 0 {
+		var err error
+		if interval, err = throttle.Interval(rate / float64(producers)); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v.\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+	if idempotent && acks != "" && acks != "all" && acks != "-1" {
+		fmt.Fprintln(os.Stderr, "ERROR: the idempotent producer requires '-acks all'.")
+		flag.Usage()
+		os.Exit(1)
+	}
 }
 
-// Generate a random message with the uuid package.
-func getRandomMessage() *Message {
-	value := uuid.NewString()
+// onDelivery records the delivery report e in stats.
+func onDelivery(e kafka.Event, stats *Stats, logger *slog.Logger) {
+	msg, ok := e.(*kafka.Message)
+	if !ok {
+		return
+	}
+	if msg.TopicPartition.Error != nil {
+		wrapper.MessageLogger(logger, msg).Debug("message not delivered",
+			"err", msg.TopicPartition.Error)
+		stats.Failed(msg.TopicPartition.Error)
+		return
+	}
+	stats.Delivered(time.Since(msg.Opaque.(time.Time)))
+}
 
-	return &Message{
-		Value: value,
+// handleEvents reads the delivery reports and errors of the producer p until
+// done is closed. Afterwards all delivery reports left in deliveries are
+// processed and finished is closed.
+func handleEvents(p *kafka.Producer, deliveries <-chan kafka.Event, stats *Stats,
+	logger *slog.Logger, done <-chan struct{}, finished chan<- struct{}) {
+	defer close(finished)
+	for {
+		select {
+		case <-done:
+			for {
+				select {
+				case e := <-deliveries:
+					onDelivery(e, stats, logger)
+				default:
+					return
+				}
+			}
+		case e := <-deliveries:
+			onDelivery(e, stats, logger)
+		case e := <-p.Events():
+			if err, ok := e.(kafka.Error); ok {
+				logger.Warn("producer error", "err", err)
+			}
+		}
 	}
 }
 
-func main() {
-	p, err := kafka.NewProducer(&kafka.ConfigMap{
-		"bootstrap.servers": Broker,
-	})
-	defer p.Close()
+// runProducer produces messages with its own Kafka producer until stop is
+// closed or the total number of messages is reached. The sequence number of
+// each message is taken from seq.
+func runProducer(id int, seq *int64, stop <-chan struct{}, stats *Stats) error {
+	logger := slog.With("broker", broker, "topic", topic, "producer", id)
 
+	r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	payload, err := NewPayloadGenerator(r, payloadKind, size, tmpl)
 	if err != nil {
-		log.Fatalf("failed to create producer: %v\n", err)
+		return err
+	}
+	key, err := NewKeyGenerator(r, keyKind, keySpace)
+	if err != nil {
+		return err
 	}
 
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+	config := kafka.ConfigMap{}
+	if partitioner != "" {
+		config.SetKey("partitioner", partitioner)
+	}
+	if acks != "" {
+		config.SetKey("acks", acks)
+	}
+	if idempotent {
+		// The idempotent producer ensures that messages are delivered exactly
+		// once and in order per partition, even if the producer retries.
+		config.SetKey("enable.idempotence", true)
+	}
+	p, err := kafkaConfig.NewProducer(broker, config)
+	if err != nil {
+		return fmt.Errorf("failed to create producer: %w", err)
+	}
+	defer p.Close()
 
-	run := true
-	for run {
-		select {
-		case <-done:
-			run = false
-		case <-time.After(1 * time.Second):
-			value, _ := json.Marshal(getRandomMessage())
-
-			// Publish some random data...
-			msg := &kafka.Message{
-				TopicPartition: kafka.TopicPartition{Topic: &topic},
-				Value:          value,
-				Key:            value,
+	deliveries := make(chan kafka.Event, 10000)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go handleEvents(p, deliveries, stats, logger, done, finished)
+
+	// Wait for all outstanding delivery reports before the producer is
+	// closed, otherwise messages still in the local queue are lost.
+	defer func() {
+		if remaining := p.Flush(int(flushTimeout.Milliseconds())); remaining > 0 {
+			logger.Warn("messages not delivered within flush timeout",
+				"remaining", remaining, "timeout", flushTimeout)
+			stats.Undelivered(remaining)
+		}
+		close(done)
+		<-finished
+	}()
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		if tick != nil {
+			select {
+			case <-stop:
+				return nil
+			case <-tick:
 			}
-			if err = p.Produce(msg, nil); err != nil {
-				log.Printf("message cannot be produced: %v\n", err)
-			} else {
-				log.Printf("message produced: %v\n", string(msg.Value))
+		} else {
+			select {
+			case <-stop:
+				return nil
+			default:
 			}
 		}
+
+		n := atomic.AddInt64(seq, 1)
+		if count > 0 && n > count {
+			return nil
+		}
+
+		value := payload(n)
+		msg := &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+			Value:          value,
+			Key:            key(n, value),
+		}
+
+		for {
+			msg.Opaque = time.Now()
+			err = p.Produce(msg, deliveries)
+			// Wait until the local queue has space again.
+			if err != nil && err.(kafka.Error).Code() == kafka.ErrQueueFull {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			break
+		}
+		if err != nil {
+			logger.Error("message cannot be produced", "err", err)
+			stats.Failed(err)
+			continue
+		}
+		stats.Produced(len(value))
+		logger.Debug("message produced", "value", string(msg.Value))
+	}
+}
+
+func main() {
+	stop := make(chan struct{})
+	go func() {
+		done := make(chan os.Signal, 1)
+		signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+		var timeout <-chan time.Time
+		if duration > 0 {
+			timeout = time.After(duration)
+		}
+
+		select {
+		case <-done:
+		case <-timeout:
+		}
+		close(stop)
+	}()
+
+	stats := &Stats{}
+	var seq int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < producers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if err := runProducer(id, &seq, stop, stats); err != nil {
+				logging.Fatal("producer failed", "producer", id, "err", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats.Print(os.Stdout, time.Since(start))
+	if stats.Lost() > 0 {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	Value string
+}
+
+// Generate a random message with the uuid package.
+func getRandomMessage() *Message {
+	value := uuid.NewString()
+
+	return &Message{
+		Value: value,
+	}
+}
+
+// A PayloadGenerator generates the value of the n-th message of a producer.
+type PayloadGenerator func(n int64) []byte
+
+var cities = []struct {
+	Name string
+	ID   int
+}{
+	{"Mosbach", 2869120},
+	{"Stuttgart", 2825297},
+	{"Bad Mergentheim", 2953363},
+	{"Heilbronn", 2907911},
+	{"Mannheim", 2873891},
+}
+
+// weatherPayload generates a synthetic weather data record in the format
+// of the weather topic.
+func weatherPayload(r *rand.Rand, n int64) []byte {
+	city := cities[r.Intn(len(cities))]
+	tempMin := 5 + r.Float64()*10
+	tempMax := tempMin + r.Float64()*10
+	record := data.WeatherData{
+		TempCurrent: tempMin + r.Float64()*(tempMax-tempMin),
+		TempMax:     tempMax,
+		TempMin:     tempMin,
+		Comment:     fmt.Sprintf("Publ.Id %v", n),
+		TimeStamp:   time.Now(),
+		City:        city.Name,
+		CityID:      city.ID,
+	}
+	value, _ := json.Marshal(record)
+	return value
+}
+
+// tankerkoenigPayload generates a synthetic record in the format of the
+// tankerkoenig topic.
+func tankerkoenigPayload(r *rand.Rand, n int64) []byte {
+	value, _ := json.Marshal(data.TankerkoenigEntry{
+		Date:     time.Now(),
+		Station:  uuid.New(),
+		PostCode: fmt.Sprintf("%05d", r.Intn(100000)),
+		PDiesel:  1.6 + r.Float64()*0.5,
+		PE5:      1.7 + r.Float64()*0.5,
+		PE10:     1.65 + r.Float64()*0.5,
+	})
+	return value
+}
+
+// randomPayload returns a generator for random alphanumeric payloads of the
+// given size in bytes.
+func randomPayload(r *rand.Rand, size int) PayloadGenerator {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	return func(n int64) []byte {
+		value := make([]byte, size)
+		for i := range value {
+			value[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		return value
+	}
+}
+
+// templatePayload returns a generator that executes the Go template text for
+// each message. If text starts with '@', the template is read from the file
+// with the following name.
+//
+// The template can access the sequence number of the message with '.Seq'
+// and the current time with '.Time'. Additionally the functions 'uuid',
+// 'timestamp', 'randInt' and 'randFloat' are available, e.g.:
+//
+//	{"id": "{{uuid}}", "value": {{randFloat 0 10}}, "at": "{{timestamp .Time}}"}
+func templatePayload(r *rand.Rand, text string) (PayloadGenerator, error) {
+	if strings.HasPrefix(text, "@") {
+		content, err := os.ReadFile(text[1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot read template: %w", err)
+		}
+		text = string(content)
+	}
+
+	t, err := template.New("payload").Funcs(template.FuncMap{
+		"uuid": uuid.NewString,
+		"timestamp": func(t time.Time) string {
+			return t.Format(data.TimestampFormat)
+		},
+		"randInt": func(min, max int) int {
+			return min + r.Intn(max-min+1)
+		},
+		"randFloat": func(min, max float64) float64 {
+			return min + r.Float64()*(max-min)
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse template: %w", err)
+	}
+
+	return func(n int64) []byte {
+		var b bytes.Buffer
+		if err := t.Execute(&b, struct {
+			Seq  int64
+			Time time.Time
+		}{n, time.Now()}); err != nil {
+			return []byte(err.Error())
+		}
+		return b.Bytes()
+	}, nil
+}
+
+// NewPayloadGenerator creates the PayloadGenerator for the payload type kind
+// using the random source r. A generator must not be shared between
+// goroutines.
+func NewPayloadGenerator(r *rand.Rand, kind string, size int, tmpl string) (PayloadGenerator, error) {
+	switch kind {
+	case "uuid":
+		return func(n int64) []byte {
+			value, _ := json.Marshal(getRandomMessage())
+			return value
+		}, nil
+	case "random":
+		return randomPayload(r, size), nil
+	case "weather":
+		return func(n int64) []byte {
+			return weatherPayload(r, n)
+		}, nil
+	case "tankerkoenig":
+		return func(n int64) []byte {
+			return tankerkoenigPayload(r, n)
+		}, nil
+	case "template":
+		return templatePayload(r, tmpl)
+	}
+	return nil, fmt.Errorf("unknown payload type '%v'", kind)
+}
+
+// A KeyGenerator generates the key of the n-th message of a producer with
+// the given value.
+type KeyGenerator func(n int64, value []byte) []byte
+
+// NewKeyGenerator creates the KeyGenerator for the key distribution kind
+// using the random source r. The distributions 'uniform' and 'zipf' choose
+// from keySpace different keys. A generator must not be shared between
+// goroutines.
+func NewKeyGenerator(r *rand.Rand, kind string, keySpace int) (KeyGenerator, error) {
+	if keySpace < 1 {
+		return nil, fmt.Errorf("key space must be at least 1")
+	}
+
+	switch kind {
+	case "value":
+		return func(n int64, value []byte) []byte {
+			return value
+		}, nil
+	case "none":
+		return func(n int64, value []byte) []byte {
+			return nil
+		}, nil
+	case "uuid":
+		return func(n int64, value []byte) []byte {
+			return []byte(uuid.NewString())
+		}, nil
+	case "sequential":
+		return func(n int64, value []byte) []byte {
+			return []byte(strconv.FormatInt(n, 10))
+		}, nil
+	case "uniform":
+		return func(n int64, value []byte) []byte {
+			return []byte(fmt.Sprintf("key-%v", r.Intn(keySpace)))
+		}, nil
+	case "zipf":
+		z := rand.NewZipf(r, 1.1, 1, uint64(keySpace-1))
+		return func(n int64, value []byte) []byte {
+			return []byte(fmt.Sprintf("key-%v", z.Uint64()))
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown key distribution '%v'", kind)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats collects the throughput, the delivery results and the delivery
+// latencies of all producers.
+type Stats struct {
+	mu          sync.Mutex
+	produced    int64
+	bytes       int64
+	latencies   []time.Duration
+	failed      map[string]int64
+	undelivered int64
+}
+
+// Produced records a message with size bytes handed over to a producer.
+func (s *Stats) Produced(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.produced++
+	s.bytes += int64(size)
+}
+
+// Delivered records the latency between producing a message and receiving
+// its delivery report.
+func (s *Stats) Delivered(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latencies = append(s.latencies, latency)
+}
+
+// Failed records a message that couldn't be produced or delivered because
+// of err.
+func (s *Stats) Failed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed == nil {
+		s.failed = map[string]int64{}
+	}
+	s.failed[err.Error()]++
+}
+
+// Undelivered records n messages without a delivery report after flushing a
+// producer.
+func (s *Stats) Undelivered(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.undelivered += int64(n)
+}
+
+// Lost returns the number of messages that failed or weren't delivered.
+func (s *Stats) Lost() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lost := s.undelivered
+	for _, n := range s.failed {
+		lost += n
+	}
+	return lost
+}
+
+// percentile returns the p-th percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p / 100)
+	return sorted[i]
+}
+
+// Print prints a summary of the statistics for a run that took elapsed.
+func (s *Stats) Print(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seconds := elapsed.Seconds()
+	fmt.Fprintf(w, "Produced %v messages (%.1f KiB) in %v\n",
+		s.produced, float64(s.bytes)/1024, elapsed.Truncate(time.Millisecond))
+	if seconds > 0 {
+		fmt.Fprintf(w, "  Throughput: %.1f msg/s, %.1f KiB/s\n",
+			float64(s.produced)/seconds, float64(s.bytes)/1024/seconds)
+	}
+
+	var failed int64
+	for _, n := range s.failed {
+		failed += n
+	}
+	fmt.Fprintf(w, "  Delivered: %v, failed: %v, undelivered: %v\n",
+		len(s.latencies), failed, s.undelivered)
+	reasons := make([]string, 0, len(s.failed))
+	for reason := range s.failed {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "    %v: %v\n", reason, s.failed[reason])
+	}
+
+	sorted := make([]time.Duration, len(s.latencies))
+	copy(sorted, s.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	fmt.Fprintf(w, "  Latency (%v delivery reports): p50 %v, p90 %v, p99 %v, max %v\n",
+		len(sorted), percentile(sorted, 50), percentile(sorted, 90),
+		percentile(sorted, 99), percentile(sorted, 100))
+}
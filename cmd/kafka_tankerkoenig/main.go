@@ -1,16 +1,22 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
-	"github.com/google/uuid"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/health"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/kafkaclient"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/wrapper"
 	"github.com/jtaczanowski/go-graphite-client"
 )
 
@@ -26,7 +32,6 @@ const (
 	GraphiteProtocol   = "tcp"
 
 	// Application specific configuration
-	TimestampFormat     = "2006-01-02T15:04:05.000-07:00"
 	AggregationInterval = 1 * time.Hour
 	PostCodes           = 10
 )
@@ -34,23 +39,27 @@ const (
 var (
 	topic          = "tankerkoenig"
 	graphiteClient *graphite.Client
+	graphiteStatus health.Status
+	registry       schema.Registry
+	broker         string
+	kafkaConfig    *kafkaclient.Config
 )
 
 // A TankerkoenigAggregator aggregates the data from TankerkoenigEntries within
 // a time period interval.
 type TankerkoenigAggregator struct {
-	entries  []*TankerkoenigEntry
+	entries  []*data.TankerkoenigEntry
 	interval time.Duration
 }
 
 func NewTankerkoenigAggregator(interval time.Duration) *TankerkoenigAggregator {
 	return &TankerkoenigAggregator{
-		entries:  []*TankerkoenigEntry{},
+		entries:  []*data.TankerkoenigEntry{},
 		interval: interval,
 	}
 }
 
-func (t *TankerkoenigAggregator) add(entry *TankerkoenigEntry) {
+func (t *TankerkoenigAggregator) add(entry *data.TankerkoenigEntry) {
 	t.entries = append(t.entries, entry)
 }
 
@@ -60,7 +69,7 @@ func (t *TankerkoenigAggregator) empty() bool {
 
 func (t *TankerkoenigAggregator) reachedInterval() bool {
 	// If the aggregation interval is reached, aggregate...
-	return t.entries[len(t.entries)-1].date.Sub(t.entries[0].date) > t.interval
+	return t.entries[len(t.entries)-1].Date.Sub(t.entries[0].Date) > t.interval
 }
 
 // aggregate aggregates TankerkoenigEntries and returns a TankerkoenigAggregationEntry.
@@ -70,14 +79,14 @@ func (t *TankerkoenigAggregator) aggregate(postCode int32) *TankerkoenigAggregat
 	pE5 := 0.0
 	pE10 := 0.0
 	for _, entry := range t.entries {
-		pDiesel += entry.pDiesel
-		pE5 += entry.pE5
-		pE10 += entry.pE10
+		pDiesel += entry.PDiesel
+		pE5 += entry.PE5
+		pE10 += entry.PE10
 	}
 	length := float64(len(t.entries))
 
 	tankerkoenigAggregationEntry := &TankerkoenigAggregationEntry{
-		timestamp: t.entries[0].date,
+		timestamp: t.entries[0].Date,
 		postCode:  postCode,
 		pDiesel:   pDiesel / length,
 		pE5:       pE5 / length,
@@ -85,7 +94,7 @@ func (t *TankerkoenigAggregator) aggregate(postCode int32) *TankerkoenigAggregat
 	}
 
 	// Delete all entries after aggregation
-	t.entries = []*TankerkoenigEntry{}
+	t.entries = []*data.TankerkoenigEntry{}
 	return tankerkoenigAggregationEntry
 }
 
@@ -104,63 +113,22 @@ func (t TankerkoenigAggregationEntry) String() string {
 		t.timestamp, t.postCode, t.pDiesel, t.pE5, t.pE10)
 }
 
-// A TankerkoenigEntry represents an entry from the Kafka tankerkoenig topic.
-type TankerkoenigEntry struct {
-	date     time.Time
-	station  uuid.UUID
-	postCode string
-	pDiesel  float64
-	pE5      float64
-	pE10     float64
-}
-
-func NewTankerkoenigEntryFromKafkaMessage(msg *kafka.Message) (*TankerkoenigEntry, error) {
-	var tankerkoenigEntry TankerkoenigEntry
-	if err := json.Unmarshal(msg.Value, &tankerkoenigEntry); err != nil {
-		log.Printf("cannot parse message '%v' in  tankerkoenig entry: %v\n",
-			string(msg.Value), err)
-		return nil, err
-	}
-
-	return &tankerkoenigEntry, nil
-}
-
-func (t *TankerkoenigEntry) UnmarshalJSON(data []byte) error {
-	var tmp struct {
-		Date     string  `json:"date"`
-		Station  string  `json:"station"`
-		PostCode string  `json:"postCode"`
-		PDiesel  float64 `json:"pDiesel"`
-		PE5      float64 `json:"pE5"`
-		PE10     float64 `json:"pE10"`
-	}
-
-	if err := json.Unmarshal(data, &tmp); err != nil {
-		return err
-	}
-	t.station = uuid.MustParse(tmp.Station)
-	t.postCode = tmp.PostCode
-	t.pDiesel = tmp.PDiesel
-	t.pE5 = tmp.PE5
-	t.pE10 = tmp.PE10
-
-	date, err := time.Parse(TimestampFormat, tmp.Date)
+func NewTankerkoenigEntryFromKafkaMessage(msg *kafka.Message) (*data.TankerkoenigEntry, error) {
+	tankerkoenigEntry, err := data.DecodeTankerkoenigEntry(registry, msg.Value)
 	if err != nil {
-		return err
+		wrapper.MessageLogger(slog.Default(), msg).Warn(
+			"cannot parse message in tankerkoenig entry",
+			"value", string(msg.Value), "err", err)
+		return nil, err
 	}
-	t.date = date
-	return nil
-}
 
-func (t TankerkoenigEntry) String() string {
-	return fmt.Sprintf("{ date: %v, station: %v, postCode: %v, pDiesel: %v, pE5: %v, pE10: %v }",
-		t.date, t.station.String(), t.postCode, t.pDiesel, t.pE5, t.pE10)
+	return tankerkoenigEntry, nil
 }
 
 // sendTankerkoenigDataToGraphite send a TankerkoenigAggregationEntry e to a
 // Graphite database. It uses the timestamp of the
 // TankerkoenigAggregationEntry.
-func sendTankerkoenigDataToGraphite(e *TankerkoenigAggregationEntry) {
+func sendTankerkoenigDataToGraphite(logger *slog.Logger, e *TankerkoenigAggregationEntry) {
 	var metrics = map[string]float64{
 		fmt.Sprintf("%v.pDiesel", e.postCode): e.pDiesel,
 		fmt.Sprintf("%v.pE5", e.postCode):     e.pE5,
@@ -169,24 +137,32 @@ func sendTankerkoenigDataToGraphite(e *TankerkoenigAggregationEntry) {
 
 	// Send data to graphite.
 	timestamp := e.timestamp.Unix()
-	if err := graphiteClient.SendDataWithTimeStamp(metrics, timestamp); err != nil {
-		fmt.Fprintf(os.Stderr, "error while sending data to graphite: %v", err)
+	err := graphiteClient.SendDataWithTimeStamp(metrics, timestamp)
+	graphiteStatus.Set(err)
+	if err != nil {
+		logger.Error("error while sending data to graphite", "err", err)
 	} else {
-		log.Printf("Send data to graphite: %v with timestamp %v (local: %v)\n",
-			metrics, timestamp, time.Unix(timestamp, 0).Local())
+		logger.Info("send data to graphite", "metrics", metrics,
+			"timestamp", timestamp, "local", time.Unix(timestamp, 0).Local())
 	}
 }
 
-func consumeEntriesAtPartition(partition int32) chan<- interface{} {
+// consumeEntriesAtPartition aggregates the entries of the partition in the
+// background until a value is sent on the returned channel. wg is done after
+// the remaining entries are sent to Graphite.
+func consumeEntriesAtPartition(partition int32, monitor *health.Monitor, maxIdle time.Duration,
+	wg *sync.WaitGroup) chan<- interface{} {
 	stop := make(chan interface{}, 1)
-	c, err := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers": Broker,
+	logger := slog.With("broker", broker, "group", Group, "topic", topic,
+		"partition", partition)
+
+	c, err := kafkaConfig.NewConsumer(broker, kafka.ConfigMap{
 		// A 'group.id' is neccessary, set it to the Group value.
 		"group.id": Group,
 	})
 
 	if err != nil {
-		log.Fatalf("failed to create consumer: %v\n", err)
+		logging.Fatal("failed to create consumer", "broker", broker, "err", err)
 	}
 
 	// Choose a partition, read from the beginning.
@@ -197,12 +173,20 @@ func consumeEntriesAtPartition(partition int32) chan<- interface{} {
 	}}
 
 	// Assign the partition to the consumer.
-	err = c.Assign(paritions)
-	log.Println("Consumer created! Waiting for events...")
+	if err := c.Assign(paritions); err != nil {
+		logging.Fatal("failed to assign partition", "topic", topic,
+			"partition", partition, "err", err)
+	}
+	logger.Info("consumer created, waiting for events")
+
+	checks := wrapper.AddConsumerChecks(monitor,
+		fmt.Sprintf("kafka-partition-%v", partition), c, maxIdle)
 
 	// Create an aggregator for each consumer.
 	aggregator := NewTankerkoenigAggregator(AggregationInterval)
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		run := true
 		for run {
 			select {
@@ -221,10 +205,11 @@ func consumeEntriesAtPartition(partition int32) chan<- interface{} {
 						continue
 					}
 					// The client will automatically try to recover from all errors.
-					fmt.Fprintf(os.Stderr, "Consumer error: %v (%v)\n", err, msg)
+					logger.Error("consumer error", "err", err)
 					continue
 				}
 
+				checks.Beat()
 				tankerkoenigEntry, err := NewTankerkoenigEntryFromKafkaMessage(msg)
 				if err != nil {
 					continue
@@ -240,22 +225,46 @@ func consumeEntriesAtPartition(partition int32) chan<- interface{} {
 				aggregator.add(tankerkoenigEntry)
 				if aggregator.reachedInterval() {
 					tankerkoenigAggregationEntry := aggregator.aggregate(partition)
-					sendTankerkoenigDataToGraphite(tankerkoenigAggregationEntry)
+					sendTankerkoenigDataToGraphite(logger, tankerkoenigAggregationEntry)
 				}
 			}
 		}
 
 		// Send rest of data even if aggregation interval not reached
-		tankerkoenigAggregationEntry := aggregator.aggregate(partition)
-		sendTankerkoenigDataToGraphite(tankerkoenigAggregationEntry)
+		if !aggregator.empty() {
+			tankerkoenigAggregationEntry := aggregator.aggregate(partition)
+			sendTankerkoenigDataToGraphite(logger, tankerkoenigAggregationEntry)
+		}
 
-		c.Close()
+		checks.Close()
 	}()
 
 	return stop
 }
 
 func main() {
+	var healthAddr string
+	var maxIdle time.Duration
+	flag.StringVar(&broker, "broker", Broker, "Kafka bootstrap servers.")
+	flag.StringVar(&healthAddr, "health-addr", "",
+		"Address to serve /healthz and /readyz on, e.g. ':8080'. Disabled if empty.")
+	flag.DurationVar(&maxIdle, "max-idle", 0,
+		"Report unhealthy if a partition received no message within this duration. Disabled if 0.")
+	registryLocation := schema.RegisterFlag()
+	kafkaConfig = kafkaclient.RegisterFlags()
+	logConfig := logging.RegisterFlags("info")
+	flag.Parse()
+	logConfig.Setup("kafka_tankerkoenig")
+	kafkaConfig.Setup()
+
+	var err error
+	if registry, err = schema.Open(*registryLocation); err != nil {
+		logging.Fatal("cannot open schema registry", "err", err)
+	}
+
+	monitor := health.NewMonitor()
+	monitor.AddReadinessCheck("graphite", graphiteStatus.Check)
+
 	graphiteClient = graphite.NewClient(GraphiteHost, GraphitePort,
 		GraphiteMetricsPfx, GraphiteProtocol)
 
@@ -263,16 +272,19 @@ func main() {
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
 	stopChannels := make([]chan<- interface{}, PostCodes)
+	var wg sync.WaitGroup
 
 	// Run a consumer for each parition, where the total number of
 	// PostCode ranges (0-9) equals the number of partitions in this case.
 	for i := 0; i < PostCodes; i++ {
-		stopChannels[i] = consumeEntriesAtPartition(int32(i))
+		stopChannels[i] = consumeEntriesAtPartition(int32(i), monitor, maxIdle, &wg)
 	}
+	monitor.ListenAndServe(healthAddr)
 
-	// Stop all aggregators
+	// Stop all aggregators and wait until they sent their remaining data.
 	<-stop
 	for _, stopChannel := range stopChannels {
 		stopChannel <- struct{}{}
 	}
+	wg.Wait()
 }
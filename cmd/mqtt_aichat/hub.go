@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// A SlowClientPolicy decides what happens if the buffer of a websocket
+// connection is full, because the browser doesn't read its messages fast
+// enough.
+type SlowClientPolicy string
+
+const (
+	// DropMessages drops the messages that don't fit into the buffer.
+	DropMessages SlowClientPolicy = "drop"
+	// DisconnectSlowClients closes the connection, so the browser has to
+	// reconnect.
+	DisconnectSlowClients SlowClientPolicy = "disconnect"
+)
+
+// ParseSlowClientPolicy parses a policy, which is 'drop' or 'disconnect'.
+func ParseSlowClientPolicy(s string) (SlowClientPolicy, error) {
+	switch p := SlowClientPolicy(s); p {
+	case DropMessages, DisconnectSlowClients:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid slow client policy '%v', must be '%v' or '%v'",
+		s, DropMessages, DisconnectSlowClients)
+}
+
+// A Subscriber receives the events of a user from a Hub, usually to send them
+// to a websocket connection.
+type Subscriber struct {
+	events  chan *Event
+	done    chan struct{}
+	once    sync.Once
+	dropped int
+}
+
+// Events returns the buffered events of the subscriber.
+func (s *Subscriber) Events() <-chan *Event {
+	return s.events
+}
+
+// Done is closed if the subscriber was closed by the hub, e.g. because it was
+// too slow.
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// close closes the subscriber. It may be called more than once.
+func (s *Subscriber) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// A Hub broadcasts the events of a user, i.e. the messages of all joined rooms
+// and the state of the rooms, to all of their websocket connections. Each
+// subscriber has a bounded buffer, so a slow connection doesn't block the
+// others. It is safe for concurrent use.
+type Hub struct {
+	bufferSize int
+	policy     SlowClientPolicy
+
+	mu          sync.Mutex
+	subscribers map[*Subscriber]struct{}
+}
+
+// NewHub creates a hub with a buffer of bufferSize events per subscriber and
+// the policy for subscribers with a full buffer.
+func NewHub(bufferSize int, policy SlowClientPolicy) *Hub {
+	return &Hub{
+		bufferSize:  bufferSize,
+		policy:      policy,
+		subscribers: map[*Subscriber]struct{}{},
+	}
+}
+
+// Subscribe adds a subscriber for the events of the hub.
+func (h *Hub) Subscribe() *Subscriber {
+	s := &Subscriber{
+		events: make(chan *Event, h.bufferSize),
+		done:   make(chan struct{}),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe removes and closes the subscriber s.
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, s)
+	s.close()
+}
+
+// Broadcast sends e to all subscribers. Broadcast never blocks: if the buffer
+// of a subscriber is full, the event is dropped or the subscriber is closed,
+// depending on the policy.
+func (h *Hub) Broadcast(e *Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subscribers {
+		h.send(s, e)
+	}
+}
+
+// Send sends e to the subscriber s only, like Broadcast.
+func (h *Hub) Send(s *Subscriber, e *Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[s]; ok {
+		h.send(s, e)
+	}
+}
+
+// send sends e to s and applies the policy if the buffer of s is full. h.mu
+// must be held.
+func (h *Hub) send(s *Subscriber, e *Event) {
+	select {
+	case s.events <- e:
+		return
+	default:
+	}
+
+	switch h.policy {
+	case DisconnectSlowClients:
+		slog.Warn("disconnecting slow client", "type", e.Type)
+		delete(h.subscribers, s)
+		s.close()
+	default:
+		s.dropped++
+		slog.Debug("dropping event for slow client", "type", e.Type, "dropped", s.dropped)
+	}
+}
+
+// Close closes all subscribers.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subscribers {
+		delete(h.subscribers, s)
+		s.close()
+	}
+}
@@ -3,15 +3,21 @@ package main
 import (
 	"embed"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/health"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/mqttconn"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
 	"golang.org/x/net/websocket"
@@ -21,8 +27,7 @@ import (
 var content embed.FS
 
 const (
-	MQTTHost = "10.50.12.150"
-	MQTTPort = 1883
+	MQTTBroker = "tcp://10.50.12.150:1883"
 
 	ChatRootTopic        = "/aichat/"
 	ChatClientStateTopic = "clientstate"
@@ -31,8 +36,11 @@ const (
 	UIPort = 5556
 )
 
-var userClient *UserClient
-var msgQueue chan *Message
+var (
+	mqttConfig  *mqttconn.Config
+	sessions    *SessionStore
+	lastMessage = health.NewHeartbeat()
+)
 
 type Message struct {
 	Sender   string `json:"sender"`
@@ -46,105 +54,233 @@ type LoginCredentials struct {
 	Room string
 }
 
+// A UserClient is the MQTT client of a user. It broadcasts the messages of the
+// joined rooms to all websocket connections of the user.
 type UserClient struct {
-	internal mqtt.Client
-	clientID string
-	Messages []*Message
-	Name     string
-	Room     string
+	internal  *mqttconn.Connection
+	clientID  string
+	brokers   string
+	hub       *Hub
+	stop      chan struct{}
+	startOnce sync.Once
+
+	mu      sync.Mutex
+	started bool
+	Name    string
+	// rooms holds the unread messages of each joined room.
+	rooms  map[string]int
+	active string
 }
 
-func (u *UserClient) JoinRoom(c *LoginCredentials) error {
-	topic := fmt.Sprintf("%v%v", ChatRootTopic, c.Room)
-	token := u.internal.Subscribe(topic, 0, nil)
-	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("cannot subscribe topic '%v': %w", c.Room, token.Error())
+// SetName sets the name the user sends messages with.
+func (u *UserClient) SetName(name string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.Name = name
+}
+
+// Credentials returns the name of the user and the active room.
+func (u *UserClient) Credentials() *LoginCredentials {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return &LoginCredentials{u.Name, u.active}
+}
+
+// publishHandler broadcasts the incoming messages to the websocket
+// connections of the user.
+func (u *UserClient) publishHandler(client mqtt.Client, msg mqtt.Message) {
+	// Get new messages from MQTT and broadcast them to the hub.
+	var data Message
+	if err := json.Unmarshal(msg.Payload(), &data); err != nil {
+		slog.Warn("cannot receive data from mqtt", "topic", msg.Topic(),
+			"payload", string(msg.Payload()), "err", err)
+		return
 	}
+	lastMessage.Beat()
+	u.receive(strings.TrimPrefix(msg.Topic(), ChatRootTopic), &data)
+}
 
-	u.Name = c.Name
-	u.Room = c.Room
-	return nil
+// notifyState reports a change of the connection state to the user as a
+// message from the system to all websocket connections of the user.
+func (u *UserClient) notifyState(s mqttconn.State, err error) {
+	var text string
+	switch s {
+	case mqttconn.Connected:
+		text = "Connected to the chat server."
+	case mqttconn.Reconnecting:
+		text = "Connection to the chat server lost, reconnecting..."
+	default:
+		return
+	}
+	u.hub.Broadcast(u.systemMessage(text))
 }
 
-func publishHandler() (chan *Message, mqtt.MessageHandler) {
-	// Create a message queue
-	msgQueue := make(chan *Message)
-	f := func(client mqtt.Client, msg mqtt.Message) {
-		// Get new messages from MQTT and write them in the message queue.
-		var data Message
-		if err := json.Unmarshal(msg.Payload(), &data); err != nil {
-			log.Printf("cannot receive data from mqtt: %v\n", err)
-			return
-		}
-		msgQueue <- &data
+// systemMessage returns the event of a message from the system to the user.
+func (u *UserClient) systemMessage(text string) *Event {
+	return &Event{
+		Type:      MessageEvent,
+		Message:   &Message{Sender: "System", Text: text},
+		Me:        u.clientID,
+		Timestamp: time.Now().Local().UnixMilli(),
 	}
-	return msgQueue, f
+}
+
+// Start connects the client to the broker in the background. It is called on
+// the first websocket connection of the session, so sessions whose chat
+// window is never opened don't connect. Rooms joined before are subscribed
+// as soon as the client is connected. Start may be called more than once.
+func (u *UserClient) Start() {
+	u.startOnce.Do(func() {
+		u.mu.Lock()
+		u.started = true
+		u.mu.Unlock()
+
+		go func() {
+			if err := u.internal.Connect(u.stop); err != nil {
+				return
+			}
+			slog.Info("connected to broker", "brokers", u.brokers, "clientId", u.clientID)
+			// Send welcome message
+			u.internal.Publish(
+				fmt.Sprintf("%v%v", ChatRootTopic, ChatClientStateTopic),
+				byte(0), false,
+				fmt.Sprintf("Chat Client %v started", u.clientID))
+		}()
+	})
+}
+
+// Started reports whether Start was called.
+func (u *UserClient) Started() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.started
+}
+
+// Close stops the client, closes its websocket connections and disconnects it
+// from the broker.
+func (u *UserClient) Close() {
+	close(u.stop)
+	u.hub.Close()
+	if u.internal.State() == mqttconn.Connected {
+		token := u.internal.Publish(
+			fmt.Sprintf("%v%v", ChatRootTopic, ChatClientStateTopic),
+			byte(0), false,
+			fmt.Sprintf("Chat Client %v stopped", u.clientID))
+		token.WaitTimeout(time.Second)
+	}
+	u.internal.Disconnect(250)
 }
 
 func websocketHandler(ws *websocket.Conn) {
-	// Run message handler in separate goroutine.
-	runMessageHandler(ws, msgQueue)
+	session := sessions.Get(ws.Request())
+	if session == nil {
+		slog.Info("websocket without session", "remote", ws.Request().RemoteAddr)
+		ws.Close()
+		return
+	}
+	session.Attach()
+	defer session.Detach()
+	userClient := session.Client
+	userClient.Start()
+
+	// Send the events in a separate goroutine, starting with the state of
+	// the rooms.
+	subscriber := userClient.hub.Subscribe()
+	defer userClient.hub.Unsubscribe(subscriber)
+	userClient.hub.Send(subscriber, userClient.roomsEvent())
+	go writeEvents(ws, subscriber)
 
 	for {
 		var receivedData []byte
 
 		if err := websocket.Message.Receive(ws, &receivedData); err != nil {
-			log.Printf("cannot receive data from ws: %v\n", err)
+			slog.Info("cannot receive data from ws", "remote", ws.Request().RemoteAddr,
+				"err", err)
 			return
 		}
+		session.Touch()
 
-		var data struct {
-			Text string `json:"text"`
+		var data command
+		if err := json.Unmarshal(receivedData, &data); err != nil {
+			slog.Warn("invalid command from ws", "remote", ws.Request().RemoteAddr,
+				"err", err)
+			continue
 		}
-		json.Unmarshal(receivedData, &data)
-
-		// Create message from received data.
-		message := &Message{
-			Sender:   userClient.Name,
-			Text:     data.Text,
-			ClientID: userClient.clientID,
-			Topic:    fmt.Sprintf("%v%v", ChatRootTopic, userClient.Room)}
-		json, _ := json.Marshal(message)
-
-		token := userClient.internal.Publish(message.Topic, byte(0), false, json)
-		if token.Wait() && token.Error() != nil {
-			log.Println("websocketHandler", token.Error())
+		if err := handleCommand(userClient, &data); err != nil {
+			slog.Warn("cannot handle command", "clientId", userClient.clientID,
+				"type", data.Type, "room", data.Room, "err", err)
+			userClient.hub.Send(subscriber, userClient.systemMessage(fmt.Sprintf("Error: %v.", err)))
 		}
 	}
 }
 
-func runMessageHandler(ws *websocket.Conn, msgQueue chan *Message) {
-	go func() {
-		for msg := range msgQueue {
-			onMsgReceived(ws, msg)
-		}
-	}()
+// A command is sent by the user interface over the websocket. The type is
+// 'message' to send the text to the active room, which is also the default,
+// or 'join', 'leave' and 'switch' to change the rooms.
+type command struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	Room string `json:"room"`
 }
 
-type extendedMsg struct {
-	*Message
-	Me        string `json:"me"`
-	Timestamp int64  `json:"timeStamp"`
-}
+// handleCommand executes the command c of the user.
+func handleCommand(userClient *UserClient, c *command) error {
+	room := strings.TrimSpace(c.Room)
+	switch c.Type {
+	case "join":
+		return userClient.JoinRoom(room)
+	case "leave":
+		return userClient.LeaveRoom(room)
+	case "switch":
+		return userClient.SwitchRoom(room)
+	case "", "message":
+	default:
+		return fmt.Errorf("unknown command '%v'", c.Type)
+	}
 
-func onMsgReceived(ws *websocket.Conn, msg *Message) {
-	extendedMsg := extendedMsg{
-		msg, userClient.clientID, time.Now().Local().UnixMilli(),
+	// Create message from received data.
+	credentials := userClient.Credentials()
+	if credentials.Room == "" {
+		return errors.New("join a room to send messages")
 	}
+	message := &Message{
+		Sender:   credentials.Name,
+		Text:     c.Text,
+		ClientID: userClient.clientID,
+		Topic:    roomTopic(credentials.Room)}
+	json, _ := json.Marshal(message)
+
+	token := userClient.internal.Publish(message.Topic, byte(0), false, json)
+	if token.Wait() && token.Error() != nil {
+		slog.Error("cannot publish message", "clientId", message.ClientID,
+			"room", credentials.Room, "topic", message.Topic, "err", token.Error())
+		return errors.New("cannot send message")
+	}
+	return nil
+}
 
-	bytes, _ := json.Marshal(extendedMsg)
-	log.Println("onMsgReceived", string(bytes))
+// writeEvents sends the events of the subscriber to the websocket ws until
+// the subscriber is closed. If an event can't be sent, ws is closed, so the
+// browser reconnects.
+func writeEvents(ws *websocket.Conn, subscriber *Subscriber) {
+	defer ws.Close()
+	for {
+		var e *Event
+		select {
+		case e = <-subscriber.Events():
+		case <-subscriber.Done():
+			return
+		}
 
-	if err := websocket.Message.Send(ws, string(bytes)); err != nil {
-		log.Printf("cannot send data to ws: %v\n", err)
-		// This is a workaround for simple usage.
-		// if the message couldn't be send to the websocket, close this
-		// socket and send the message back into the queue.
-		// WARNING: If no websocket is available the queue will flooeded
-		// with the hanging message and performs an endless loop until
-		// a new websocket is connected which can handle the message.
-		ws.Close()
-		msgQueue <- msg
+		bytes, _ := json.Marshal(e)
+		slog.Debug("event received", "type", e.Type, "room", e.Room,
+			"payload", string(bytes))
+
+		if err := websocket.Message.Send(ws, string(bytes)); err != nil {
+			slog.Warn("cannot send data to ws", "remote", ws.Request().RemoteAddr,
+				"err", err)
+			return
+		}
 	}
 }
 
@@ -152,38 +288,78 @@ func generateRandomClientID() string {
 	return uuid.NewString()
 }
 
-func connectToMQTT(defaultHandler mqtt.MessageHandler) *UserClient {
+// newUserClient creates the client of a new session, which broadcasts the
+// messages to hub. It doesn't connect until Start is called and then
+// reconnects automatically, so the user interface is available even if the
+// broker isn't.
+func newUserClient(config *mqttconn.Config, hub *Hub) (*UserClient, error) {
+	opts, err := config.Options()
+	if err != nil {
+		return nil, err
+	}
+	u := &UserClient{
+		clientID: generateRandomClientID(),
+		brokers:  config.Brokers,
+		hub:      hub,
+		stop:     make(chan struct{}),
+		rooms:    map[string]int{},
+	}
 	// Set client options
-	opts := mqtt.NewClientOptions().
-		AddBroker(fmt.Sprintf("tcp://%v:%v", MQTTHost, MQTTPort)).
-		SetClientID(generateRandomClientID()).
-		SetDefaultPublishHandler(defaultHandler)
+	opts.SetClientID(u.clientID).
+		SetDefaultPublishHandler(u.publishHandler)
 	// Set 'Last Will' message
 	opts.SetWill(
 		fmt.Sprintf("%v%v", ChatRootTopic, ChatClientStateTopic),
 		fmt.Sprintf("Chat Client %v stopped", opts.ClientID),
 		byte(0), false)
 
-	// Create client
-	c := mqtt.NewClient(opts)
-	if token := c.Connect(); token.Wait() && token.Error() != nil {
-		log.Println("connectToMQTT", token.Error())
-		os.Exit(1)
-	}
-	// Send welcome message
-	c.Publish(
-		fmt.Sprintf("%v%v", ChatRootTopic, ChatClientStateTopic),
-		byte(0), false,
-		fmt.Sprintf("Chat Client %v started", opts.ClientID))
-
-	return &UserClient{c, opts.ClientID, make([]*Message, 0), "", ""}
+	u.internal = mqttconn.NewConnection(opts, u.notifyState)
+	return u, nil
 }
 
 func main() {
-	mq, publishHandler := publishHandler()
-	msgQueue = mq
+	var maxIdle, sessionTimeout time.Duration
+	var bufferSize int
+	var slowClients string
+	flag.DurationVar(&maxIdle, "max-idle", 0,
+		"Report unhealthy if no message was received within this duration. Disabled if 0.")
+	flag.DurationVar(&sessionTimeout, "session-timeout", 30*time.Minute,
+		"Close the session of a user without open chat window after this duration.")
+	flag.IntVar(&bufferSize, "ws-buffer", 64,
+		"Number of messages buffered for each chat window before the slow client policy applies.")
+	flag.StringVar(&slowClients, "slow-client", string(DropMessages),
+		fmt.Sprintf("Policy for chat windows with a full buffer, '%v' the messages or '%v' the window.",
+			DropMessages, DisconnectSlowClients))
+	mqttConfig = mqttconn.RegisterFlags(MQTTBroker)
+	logConfig := logging.RegisterFlags("info")
+	flag.Parse()
+	logConfig.Setup("mqtt_aichat")
+	var errs []error
+	if sessionTimeout <= 0 {
+		errs = append(errs, errors.New("the session timeout must be positive"))
+	}
+	if bufferSize < 1 {
+		errs = append(errs, errors.New("the websocket buffer must hold at least one message"))
+	}
+	policy, err := ParseSlowClientPolicy(slowClients)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "ERROR: %v.\n", err)
+		}
+		flag.Usage()
+		os.Exit(1)
+	}
+	// Validate the connection flags once, the options are created for each
+	// session.
+	mqttConfig.Setup()
 
-	userClient = connectToMQTT(publishHandler)
+	sessions = NewSessionStore(sessionTimeout, func() (*UserClient, error) {
+		return newUserClient(mqttConfig, NewHub(bufferSize, policy))
+	})
+	go sessions.RunExpiry(time.Minute)
 
 	// Set up web assets
 	assets, _ := fs.Sub(content, "web/static")
@@ -195,22 +371,39 @@ func main() {
 		name := strings.TrimSpace(query.Get("name"))
 		room := strings.TrimSpace(query.Get("room"))
 
-		// If either of the parameters are set to null, show login page.
+		// If either of the parameters are set to null, show login page. It's
+		// prefilled with the credentials of the session, if any.
 		if name == "" || room == "" {
+			credentials := &LoginCredentials{"", ChatDefaultRoom}
+			if session := sessions.Get(r); session != nil {
+				c := session.Client.Credentials()
+				credentials.Name = c.Name
+				if c.Room != "" {
+					credentials.Room = c.Room
+				}
+			}
 			t := template.Must(template.ParseFS(content, "web/templates/login.html"))
-			t.Execute(w, &LoginCredentials{"", ChatDefaultRoom})
+			t.Execute(w, credentials)
+			return
+		}
+
+		session, err := sessions.GetOrCreate(w, r)
+		if err != nil {
+			slog.Error("cannot create session", "err", err)
+			http.Error(w, "cannot create session", http.StatusServiceUnavailable)
 			return
 		}
+		userClient := session.Client
+
 		// URL parameters are set
 		loginCredentials := &LoginCredentials{name, room}
-		if err := userClient.JoinRoom(loginCredentials); err != nil {
-			log.Printf("cannot join room: %v\n", err)
+		userClient.SetName(name)
+		if err := userClient.JoinRoom(room); err != nil {
+			slog.Error("cannot join room", "clientId", userClient.clientID,
+				"room", room, "err", err)
 			t := template.Must(template.ParseFS(content, "web/templates/login.html"))
-			t.Execute(w, &LoginCredentials{"", ChatDefaultRoom})
+			t.Execute(w, &LoginCredentials{name, ChatDefaultRoom})
 			return
-		} else {
-			log.Printf("client '%v' with name '%v' joined room '%v'\n",
-				userClient.clientID, userClient.Name, userClient.Room)
 		}
 
 		// Show main application
@@ -220,7 +413,14 @@ func main() {
 
 	http.Handle("/ws", websocket.Handler(websocketHandler))
 
+	// Serve health endpoints on the same port as the user interface.
+	monitor := health.NewMonitor()
+	monitor.AddLivenessCheck("mqtt-last-message", lastMessage.Check(maxIdle))
+	monitor.AddReadinessCheck("mqtt-broker", sessions.Check)
+	monitor.Register(http.DefaultServeMux)
+
 	fmt.Printf("Start server... Open a webbrowser on http://localhost:%v to start chatting.\n", UIPort)
 	// Start web server
-	log.Fatalln(http.ListenAndServe(fmt.Sprintf(":%v", UIPort), nil))
+	err = http.ListenAndServe(fmt.Sprintf(":%v", UIPort), nil)
+	logging.Fatal("web server stopped", "port", UIPort, "err", err)
 }
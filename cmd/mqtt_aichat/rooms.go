@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Types of the events sent to the websocket connections.
+const (
+	MessageEvent = "message"
+	RoomsEvent   = "rooms"
+)
+
+// An Event is sent to the websocket connections of a user. It is either a
+// message of a room or the state of all joined rooms.
+type Event struct {
+	Type string `json:"type"`
+	// Room is the room of a message. It's empty for messages of the system,
+	// which are shown in the active room.
+	Room string `json:"room,omitempty"`
+	*Message
+	Me        string `json:"me"`
+	Timestamp int64  `json:"timeStamp,omitempty"`
+	Rooms     []Room `json:"rooms,omitempty"`
+}
+
+// A Room is the state of a joined room.
+type Room struct {
+	Name string `json:"name"`
+	// Unread is the number of messages received while the room wasn't
+	// active.
+	Unread int  `json:"unread"`
+	Active bool `json:"active"`
+}
+
+// roomTopic returns the MQTT topic of room.
+func roomTopic(room string) string {
+	return fmt.Sprintf("%v%v", ChatRootTopic, room)
+}
+
+// validateRoom checks that room is a single topic level without wildcards.
+func validateRoom(room string) error {
+	if room == "" {
+		return errors.New("the room must not be empty")
+	}
+	if strings.ContainsAny(room, "+#/") {
+		return fmt.Errorf("invalid room '%v', must not contain '+', '#' or '/'", room)
+	}
+	return nil
+}
+
+// JoinRoom subscribes the topic of room and makes it the active room. If the
+// room is already joined, it is only activated.
+func (u *UserClient) JoinRoom(room string) error {
+	if err := validateRoom(room); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	_, joined := u.rooms[room]
+	u.mu.Unlock()
+
+	if !joined {
+		// The subscription is restored if the connection is reestablished.
+		if err := u.internal.Subscribe(roomTopic(room), 0, nil); err != nil {
+			return fmt.Errorf("cannot subscribe topic '%v': %w", room, err)
+		}
+		slog.Info("client joined room", "clientId", u.clientID, "room", room)
+	}
+
+	u.mu.Lock()
+	u.rooms[room] = 0
+	u.active = room
+	u.mu.Unlock()
+	u.hub.Broadcast(u.roomsEvent())
+	return nil
+}
+
+// LeaveRoom unsubscribes the topic of room. If it was the active room, the
+// first of the remaining rooms becomes active.
+func (u *UserClient) LeaveRoom(room string) error {
+	u.mu.Lock()
+	_, joined := u.rooms[room]
+	u.mu.Unlock()
+	if !joined {
+		return fmt.Errorf("room '%v' not joined", room)
+	}
+
+	if err := u.internal.Unsubscribe(roomTopic(room)); err != nil {
+		return fmt.Errorf("cannot unsubscribe topic '%v': %w", room, err)
+	}
+	slog.Info("client left room", "clientId", u.clientID, "room", room)
+
+	u.mu.Lock()
+	delete(u.rooms, room)
+	if u.active == room {
+		u.active = ""
+		if rooms := u.roomNames(); len(rooms) > 0 {
+			u.active = rooms[0]
+			u.rooms[u.active] = 0
+		}
+	}
+	u.mu.Unlock()
+	u.hub.Broadcast(u.roomsEvent())
+	return nil
+}
+
+// SwitchRoom makes the joined room the active room and resets its unread
+// messages.
+func (u *UserClient) SwitchRoom(room string) error {
+	u.mu.Lock()
+	_, joined := u.rooms[room]
+	if joined {
+		u.rooms[room] = 0
+		u.active = room
+	}
+	u.mu.Unlock()
+	if !joined {
+		return fmt.Errorf("room '%v' not joined", room)
+	}
+	u.hub.Broadcast(u.roomsEvent())
+	return nil
+}
+
+// receive broadcasts a message of room and counts it as unread if room isn't
+// active. Messages of rooms which were left in the meantime are dropped.
+func (u *UserClient) receive(room string, msg *Message) {
+	u.mu.Lock()
+	unread, joined := u.rooms[room]
+	active := room == u.active
+	if joined && !active {
+		u.rooms[room] = unread + 1
+	}
+	u.mu.Unlock()
+	if !joined {
+		slog.Debug("dropping message of left room", "clientId", u.clientID, "room", room)
+		return
+	}
+
+	u.hub.Broadcast(&Event{
+		Type:      MessageEvent,
+		Room:      room,
+		Message:   msg,
+		Me:        u.clientID,
+		Timestamp: time.Now().Local().UnixMilli(),
+	})
+	if !active {
+		u.hub.Broadcast(u.roomsEvent())
+	}
+}
+
+// roomNames returns the names of the joined rooms in alphabetical order.
+// u.mu must be held.
+func (u *UserClient) roomNames() []string {
+	names := make([]string, 0, len(u.rooms))
+	for name := range u.rooms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// roomsEvent returns the event with the state of all joined rooms.
+func (u *UserClient) roomsEvent() *Event {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	e := &Event{Type: RoomsEvent, Me: u.clientID}
+	for _, name := range u.roomNames() {
+		e.Rooms = append(e.Rooms, Room{name, u.rooms[name], name == u.active})
+	}
+	return e
+}
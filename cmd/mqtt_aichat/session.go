@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/mqttconn"
+	"github.com/google/uuid"
+)
+
+// SessionCookie is the name of the cookie holding the session ID.
+const SessionCookie = "aichat_session"
+
+// UnattachedTimeout is the timeout of sessions which never had a websocket
+// connection, e.g. because only the page was requested. It is shorter than
+// the session timeout, so such sessions don't pile up.
+const UnattachedTimeout = time.Minute
+
+// A Session holds the state of a user of the chat, who is identified by a
+// cookie. Each session has its own MQTT client, so several users can chat
+// with different names in different rooms on the same server.
+type Session struct {
+	ID     string
+	Client *UserClient
+
+	mu       sync.Mutex
+	lastSeen time.Time
+	conns    int
+	attached bool
+}
+
+// Touch marks the session as used.
+func (s *Session) Touch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSeen = time.Now()
+}
+
+// Attach registers a websocket connection of the session. A session doesn't
+// expire while it has connections.
+func (s *Session) Attach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns++
+	s.attached = true
+	s.lastSeen = time.Now()
+}
+
+// Detach unregisters a websocket connection of the session.
+func (s *Session) Detach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns--
+	s.lastSeen = time.Now()
+}
+
+// expired reports whether the session has no connections and wasn't used
+// within timeout, or within UnattachedTimeout if it never had a connection.
+func (s *Session) expired(now time.Time, timeout time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.attached && UnattachedTimeout < timeout {
+		timeout = UnattachedTimeout
+	}
+	return s.conns == 0 && now.Sub(s.lastSeen) > timeout
+}
+
+// A SessionStore holds the sessions of all users. It is safe for concurrent
+// use.
+type SessionStore struct {
+	timeout   time.Duration
+	newClient func() (*UserClient, error)
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewSessionStore creates a store, which creates the client of each new
+// session with newClient. Sessions expire if they have no websocket
+// connection and weren't used within timeout, see Session.expired.
+func NewSessionStore(timeout time.Duration, newClient func() (*UserClient, error)) *SessionStore {
+	return &SessionStore{
+		timeout:   timeout,
+		newClient: newClient,
+		sessions:  map[string]*Session{},
+	}
+}
+
+// Get returns the session of the request r, or nil if it has none.
+func (st *SessionStore) Get(r *http.Request) *Session {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return nil
+	}
+	st.mu.Lock()
+	s := st.sessions[cookie.Value]
+	st.mu.Unlock()
+	if s != nil {
+		s.Touch()
+	}
+	return s
+}
+
+// GetOrCreate returns the session of the request r. If r has no session, a
+// new one is created and its cookie is set on w.
+func (st *SessionStore) GetOrCreate(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	if s := st.Get(r); s != nil {
+		return s, nil
+	}
+	client, err := st.newClient()
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{ID: uuid.NewString(), Client: client, lastSeen: time.Now()}
+	st.mu.Lock()
+	st.sessions[s.ID] = s
+	st.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    s.ID,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	slog.Info("session created", "clientId", client.clientID)
+	return s, nil
+}
+
+// Expire closes the clients of all expired sessions and removes them.
+func (st *SessionStore) Expire() {
+	now := time.Now()
+	var expired []*Session
+	st.mu.Lock()
+	for id, s := range st.sessions {
+		if s.expired(now, st.timeout) {
+			expired = append(expired, s)
+			delete(st.sessions, id)
+		}
+	}
+	st.mu.Unlock()
+
+	for _, s := range expired {
+		slog.Info("session expired", "clientId", s.Client.clientID)
+		s.Client.Close()
+	}
+}
+
+// RunExpiry expires sessions periodically. It never returns.
+func (st *SessionStore) RunExpiry(interval time.Duration) {
+	for range time.Tick(interval) {
+		st.Expire()
+	}
+}
+
+// Check reports an error if a started client of a session isn't connected to
+// the broker.
+func (st *SessionStore) Check() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var started, disconnected int
+	for _, s := range st.sessions {
+		if !s.Client.Started() {
+			continue
+		}
+		started++
+		if s.Client.internal.State() != mqttconn.Connected {
+			disconnected++
+		}
+	}
+	if disconnected > 0 {
+		return fmt.Errorf("%v of %v sessions not connected to broker", disconnected, started)
+	}
+	return nil
+}
@@ -1,14 +1,112 @@
 const msgerForm = document.getElementById("form");
 const msgerInput = document.getElementById("input");
 const msgerChat = document.getElementById("chat");
+const roomList = document.getElementById("rooms");
+const roomName = document.getElementById("room-name");
+const joinForm = document.getElementById("join-form");
+const joinInput = document.getElementById("join-input");
 
 console.log("executed")
 
 var socket = null;
 var uri = `ws://${window.location.host}/ws`;
 
-window.onload = function () {
-    console.log("onload")
+// The room shown in the chat, which is set by the server.
+var activeRoom = roomName.textContent;
+
+function escapeHTML(s) {
+    let div = document.createElement("div");
+    div.textContent = s;
+    return div.innerHTML;
+}
+
+// roomChat returns the container with the messages of a room and creates it
+// if it doesn't exist yet.
+function roomChat(room) {
+    for (const chat of msgerChat.children) {
+        if (chat.dataset.room === room) {
+            return chat;
+        }
+    }
+    let chat = document.createElement("div");
+    chat.className = "room-chat";
+    chat.dataset.room = room;
+    msgerChat.appendChild(chat);
+    return chat;
+}
+
+function send(data) {
+    if (socket !== null && socket.readyState === WebSocket.OPEN) {
+        socket.send(JSON.stringify(data));
+    }
+}
+
+function showRooms(rooms) {
+    activeRoom = "";
+    roomList.innerHTML = "";
+    for (const room of rooms) {
+        if (room.active) {
+            activeRoom = room.name;
+        }
+
+        let item = document.createElement("span");
+        item.className = room.active ? "msger-room active" : "msger-room";
+        item.textContent = room.name;
+        item.onclick = () => send({ type: "switch", room: room.name });
+        if (room.unread > 0) {
+            let unread = document.createElement("span");
+            unread.className = "msger-room-unread";
+            unread.textContent = room.unread;
+            item.appendChild(unread);
+        }
+        let leave = document.createElement("i");
+        leave.className = "fa fa-times msger-room-leave";
+        leave.title = "Leave room";
+        leave.onclick = event => {
+            event.stopPropagation();
+            send({ type: "leave", room: room.name });
+        };
+        item.appendChild(leave);
+        roomList.appendChild(item);
+    }
+
+    // Show the messages of the active room only.
+    for (const chat of msgerChat.children) {
+        chat.classList.toggle("active", chat.dataset.room === activeRoom);
+    }
+    roomChat(activeRoom).classList.add("active");
+    roomName.textContent = activeRoom !== "" ? activeRoom : "-";
+    document.title = `AI Chat - ${activeRoom !== "" ? activeRoom : "No room"}`;
+}
+
+function showMessage(msg) {
+    let time = new Date(msg.timeStamp)
+
+    let div = "";
+    if (msg.clientId === msg.me) {
+        div += `<div class="msg right-msg">`;
+    } else {
+        div += `<div class="msg left-msg">`;
+    }
+
+    div += `<div class="msg-bubble">
+        <div class="msg-info">
+            <div class="msg-info-name">${msg.sender !== "" ? escapeHTML(msg.sender) : "Unkown"}</div>
+            <div class="msg-info-time">${time.getHours()}:${String(time.getMinutes()).padStart(2, "0")}</div>
+        </div>
+        <div class="msg-text">
+            ${escapeHTML(msg.text)}
+        </div>
+    </div>`;
+
+    div += "</div>";
+    // Messages of the system have no room and are shown in the active room.
+    let chat = roomChat(msg.room !== undefined ? msg.room : activeRoom);
+    chat.innerHTML += div;
+    msgerChat.scrollTop = msgerChat.scrollHeight;
+}
+
+function connect() {
     socket = new WebSocket(uri);
 
     socket.onopen = function () {
@@ -16,44 +114,47 @@ window.onload = function () {
     }
 
     socket.onclose = function (event) {
-        console.log("connection closed (" + event.code + ")");
+        console.log("connection closed (" + event.code + "), reconnecting...");
+        setTimeout(connect, 1000);
     }
 
     socket.onmessage = function (event) {
         let msg = JSON.parse(event.data);
-        let time = new Date(msg.timeStamp)
-
-        let div = "";
-        if (msg.clientId === msg.me) {
-            div += `<div class="msg right-msg">`;
-        } else {
-            div += `<div class="msg left-msg">`;
+        switch (msg.type) {
+            case "rooms":
+                showRooms(msg.rooms || []);
+                break;
+            case "message":
+                showMessage(msg);
+                break;
         }
-        
-        div += `<div class="msg-bubble">
-            <div class="msg-info">
-                <div class="msg-info-name">${msg.sender !== "" ? msg.sender : "Unkown"}</div>
-                <div class="msg-info-time">${time.getHours()}:${time.getMinutes()}</div>
-            </div>
-            <div class="msg-text">
-                ${msg.text}
-            </div>
-        </div>`;
-
-        div += "</div>";
-        msgerChat.innerHTML += div; 
     }
 }
 
+window.onload = function () {
+    console.log("onload")
+    connect();
+}
+
 msgerForm.addEventListener("submit", event => {
     event.preventDefault();
 
     const msgText = msgerInput.value;
     if (!msgText) return;
 
-    let data = JSON.stringify({
+    send({
+        type: "message",
         text: msgText,
     });
+    msgerInput.value = "";
+});
+
+joinForm.addEventListener("submit", event => {
+    event.preventDefault();
+
+    const room = joinInput.value.trim();
+    if (!room) return;
 
-    socket.send(data);
-});
\ No newline at end of file
+    send({ type: "join", room: room });
+    joinInput.value = "";
+});
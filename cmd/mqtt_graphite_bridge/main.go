@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/graphitesink"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/health"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/mqttconn"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	Broker = "tcp://10.50.12.150:1883"
+
+	// CityFromPayload takes the city from the 'city' field of the payload.
+	CityFromPayload = "payload"
+)
+
+var (
+	topics       []string
+	cityLevel    *mqttconn.Level
+	format       data.Format
+	registry     schema.Registry
+	qos          int
+	clientID     string
+	cleanSession bool
+	healthAddr   string
+	maxIdle      time.Duration
+
+	opts      *mqtt.ClientOptions
+	sink      *graphitesink.Sink
+	heartbeat = health.NewHeartbeat()
+)
+
+// parseTopics parses a comma separated list of topic filters.
+func parseTopics(s string) ([]string, error) {
+	var topics []string
+	for _, topic := range strings.Split(s, ",") {
+		if topic = strings.TrimSpace(topic); topic == "" {
+			continue
+		}
+		if err := mqttconn.ValidateTopicFilter(topic); err != nil {
+			return nil, err
+		}
+		topics = append(topics, topic)
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("you must specify at least one topic")
+	}
+	return topics, nil
+}
+
+// parseCity parses the source of the city, which is 'payload' or the level
+// of the topic. It returns nil for the payload.
+func parseCity(s string) (*mqttconn.Level, error) {
+	if s == CityFromPayload {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n == 0 {
+		return nil, fmt.Errorf("invalid city '%v', must be '%v' or a topic level, e.g. '-1'", s, CityFromPayload)
+	}
+	level := mqttconn.Level(n)
+	return &level, nil
+}
+
+// handle sends the weather data of an incoming message to Graphite.
+func handle(_ mqtt.Client, msg mqtt.Message) {
+	heartbeat.Beat()
+	logger := slog.With("topic", msg.Topic())
+	w, err := format.DecodeWeatherData(registry, msg.Payload())
+	if err != nil {
+		logger.Warn("error while receiving data", "payload", string(msg.Payload()), "err", err)
+		return
+	}
+	if cityLevel != nil {
+		city, ok := cityLevel.Of(msg.Topic())
+		if !ok {
+			logger.Warn("topic has no city level", "level", *cityLevel)
+			return
+		}
+		w.City = city
+	}
+	if strings.TrimSpace(w.City) == "" {
+		logger.Warn("skipping weather data without city")
+		return
+	}
+	sink.Send(w)
+}
+
+// defaultClientID returns a client ID which is stable on this host, so a
+// restarted bridge can resume its MQTT session.
+func defaultClientID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "mqtt_graphite_bridge"
+	}
+	return fmt.Sprintf("mqtt_graphite_bridge-%v", hostname)
+}
+
+// init initializes all neccessary global variables, e.g. from the command line
+// interface.
+func init() {
+	var topic, city, formatName string
+	flag.StringVar(&topic, "topic", "/weather/+",
+		"Comma separated list of MQTT topic filters to subscribe, may contain the wildcards '+' and '#'.")
+	flag.StringVar(&city, "city", CityFromPayload,
+		"Take the city from the 'payload' or from a topic level, e.g. '-1' for the last level.")
+	flag.StringVar(&formatName, "payload-format", string(data.FormatJSON),
+		"Format of the payloads, 'json', 'protobuf' or 'avro'.")
+	flag.IntVar(&qos, "qos", 1, "QoS level of the subscriptions, 0, 1 or 2.")
+	flag.StringVar(&clientID, "client-id", defaultClientID(), "MQTT client ID.")
+	flag.BoolVar(&cleanSession, "clean-session", true,
+		"Start a new session on connect. Disable to receive the messages sent while offline.")
+	flag.StringVar(&healthAddr, "health-addr", "",
+		"Address to serve /healthz and /readyz on, e.g. ':8080'. Disabled if empty.")
+	flag.DurationVar(&maxIdle, "max-idle", 0,
+		"Report unhealthy if no message was received within this duration. Disabled if 0.")
+	mqttConfig := mqttconn.RegisterFlags(Broker)
+	registryLocation := schema.RegisterFlag()
+	logConfig := logging.RegisterFlags("info")
+	flag.Parse()
+	logConfig.Setup("mqtt_graphite_bridge")
+
+	var errs []error
+	var err error
+	if topics, err = parseTopics(topic); err != nil {
+		errs = append(errs, err)
+	}
+	if cityLevel, err = parseCity(city); err != nil {
+		errs = append(errs, err)
+	}
+	if format, err = data.ParseFormat(formatName); err != nil {
+		errs = append(errs, err)
+	}
+	if qos < 0 || qos > 2 {
+		errs = append(errs, fmt.Errorf("invalid QoS level %v, must be 0, 1 or 2", qos))
+	}
+	if !cleanSession && clientID == "" {
+		errs = append(errs, errors.New("a persistent session requires a client ID"))
+	}
+	if opts, err = mqttConfig.Options(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "ERROR: %v.\n", err)
+		}
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if registry, err = schema.Open(*registryLocation); err != nil {
+		logging.Fatal("cannot open schema registry", "err", err)
+	}
+}
+
+func main() {
+	sink = graphitesink.New(graphitesink.Host, graphitesink.Port,
+		graphitesink.MetricsPrefix, graphitesink.Protocol)
+
+	opts.SetDefaultPublishHandler(handle)
+	opts.SetClientID(clientID)
+	opts.SetCleanSession(cleanSession)
+	c := mqttconn.NewConnection(opts, nil)
+	for _, topic := range topics {
+		if err := c.Subscribe(topic, byte(qos), nil); err != nil {
+			logging.Fatal("cannot subscribe topic", "topic", topic, "err", err)
+		}
+	}
+
+	monitor := health.NewMonitor()
+	monitor.AddReadinessCheck("mqtt-broker", func() error {
+		if c.State() != mqttconn.Connected {
+			return errors.New("not connected to broker")
+		}
+		return nil
+	})
+	monitor.AddReadinessCheck("graphite", sink.Check)
+	monitor.AddLivenessCheck("last-message", heartbeat.Check(maxIdle))
+	monitor.ListenAndServe(healthAddr)
+
+	// Stop on kill
+	stop := make(chan struct{})
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-done
+		close(stop)
+	}()
+
+	if err := c.Connect(stop); err != nil {
+		return
+	}
+	slog.Info("connected, waiting for weather data", "topics", topics)
+
+	<-stop
+	if cleanSession {
+		if err := c.Unsubscribe(topics...); err != nil {
+			slog.Error("cannot unsubscribe topics", "err", err)
+		}
+	}
+	c.Disconnect(250)
+}
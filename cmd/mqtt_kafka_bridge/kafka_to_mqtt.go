@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/mqttconn"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/wrapper"
+)
+
+// runKafkaToMQTT forwards the messages of the Kafka topic to the MQTT topics
+// built from the topic template until stop is closed.
+//
+// With at-least-once delivery, the offset of a message is stored for the
+// next commit only after the MQTT broker acknowledged it, so it's consumed
+// again if the bridge fails in between. Otherwise the offsets are committed
+// independently of the delivery.
+func runKafkaToMQTT(c *kafka.Consumer, conn *mqttconn.Connection, stop <-chan struct{}) error {
+	logger := slog.With("from", kafkaTopic, "to", mqttTopic)
+
+	if err := conn.Connect(stop); err != nil {
+		return err
+	}
+	defer conn.Disconnect(250)
+
+	if err := c.Subscribe(kafkaTopic, nil); err != nil {
+		return err
+	}
+	logger.Info("bridge started", "guarantee", guarantee)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		msg, err := c.ReadMessage(100 * time.Millisecond)
+		if err != nil {
+			// Ignore the timout error.
+			if err.(kafka.Error).Code() == kafka.ErrTimedOut {
+				continue
+			}
+			// The client will automatically try to recover from all errors.
+			logger.Error("consumer error", "err", err)
+			continue
+		}
+		heartbeat.Beat()
+
+		msgLogger := wrapper.MessageLogger(logger, msg)
+		topic, err := topicTemplate.Topic(msg)
+		if err != nil {
+			msgLogger.Warn("cannot build MQTT topic, skipping message", "err", err)
+			storeOffset(c, msg)
+			continue
+		}
+
+		for {
+			token := conn.Publish(topic, byte(qos), retain, msg.Value)
+			// With QoS 0 the token completes when the message is sent, with
+			// QoS 1 and 2 when the broker acknowledged it.
+			if token.Wait() && token.Error() == nil {
+				break
+			}
+			if !atLeastOnce {
+				msgLogger.Error("cannot publish message", "mqttTopic", topic, "err", token.Error())
+				break
+			}
+			msgLogger.Error("cannot publish message, retrying", "mqttTopic", topic, "err", token.Error())
+			select {
+			case <-stop:
+				// Return without storing the offset, so the message is
+				// consumed again after a restart.
+				return nil
+			case <-time.After(time.Second):
+			}
+		}
+		storeOffset(c, msg)
+	}
+}
+
+// storeOffset stores the offset of msg for the next commit, if offsets
+// aren't stored automatically.
+func storeOffset(c *kafka.Consumer, msg *kafka.Message) {
+	if !atLeastOnce {
+		return
+	}
+	if _, err := c.StoreMessage(msg); err != nil {
+		wrapper.MessageLogger(slog.Default(), msg).Error("cannot store offset", "err", err)
+	}
+}
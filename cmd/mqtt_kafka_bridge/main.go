@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/health"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/kafkaclient"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/mqttconn"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/wrapper"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	KafkaBroker = "10.50.15.52"
+	MQTTBroker  = "tcp://10.50.12.150:1883"
+	Group       = "mqtt_kafka_bridge"
+
+	MQTTToKafka = "mqtt-to-kafka"
+	KafkaToMQTT = "kafka-to-mqtt"
+
+	AtLeastOnce = "at-least-once"
+	AtMostOnce  = "at-most-once"
+)
+
+var (
+	direction     string
+	broker        string
+	kafkaTopic    string
+	mqttTopic     string
+	group         string
+	keyLevel      *mqttconn.Level
+	headers       headerMappings
+	topicTemplate TopicTemplate
+	format        data.Format
+	qos           int
+	retain        bool
+	guarantee     string
+	atLeastOnce   bool
+	clientID      string
+	cleanSession  bool
+	healthAddr    string
+	maxIdle       time.Duration
+
+	kafkaConfig *kafkaclient.Config
+	mqttOptions *mqtt.ClientOptions
+	heartbeat   = health.NewHeartbeat()
+)
+
+// defaultClientID returns a client ID which is stable on this host, so a
+// restarted bridge resumes its MQTT session.
+func defaultClientID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return Group
+	}
+	return fmt.Sprintf("%v-%v", Group, hostname)
+}
+
+// init initializes all neccessary global variables, e.g. from the command line
+// interface.
+func init() {
+	var key, formatName string
+	flag.StringVar(&direction, "direction", MQTTToKafka,
+		fmt.Sprintf("Direction to forward messages, '%v' or '%v'.", MQTTToKafka, KafkaToMQTT))
+	flag.StringVar(&broker, "broker", KafkaBroker, "Kafka bootstrap servers.")
+	flag.StringVar(&kafkaTopic, "kafka-topic", "weather", "Kafka topic to produce to or consume from.")
+	flag.StringVar(&mqttTopic, "mqtt-topic", "",
+		"MQTT topic filter to subscribe, defaults to '/weather/+', or topic template to publish to, defaults to '/weather/{key|location}'.")
+	flag.StringVar(&group, "group", Group, "Kafka consumer group.")
+	flag.StringVar(&key, "key", "-1",
+		"MQTT topic level used as Kafka key, e.g. '2' or '-1' for the last level, 'topic' for the whole topic or 'none'.")
+	flag.Var(&headers, "header",
+		"Add an MQTT topic level as Kafka header, e.g. 'location=-1'. Can be repeated.")
+	flag.StringVar(&formatName, "payload-format", string(data.FormatJSON),
+		"Format of the MQTT payloads, 'json', 'protobuf' or 'avro', which is set as content type of the Kafka messages.")
+	flag.IntVar(&qos, "qos", 1, "MQTT QoS level to subscribe or publish with, 0, 1 or 2.")
+	flag.BoolVar(&retain, "retain", false, "Publish retained MQTT messages.")
+	flag.StringVar(&guarantee, "guarantee", AtLeastOnce,
+		fmt.Sprintf("Delivery guarantee, '%v' or '%v'.", AtLeastOnce, AtMostOnce))
+	flag.StringVar(&clientID, "client-id", defaultClientID(),
+		"MQTT client ID, which identifies the persistent session with at-least-once delivery.")
+	flag.StringVar(&healthAddr, "health-addr", "",
+		"Address to serve /healthz and /readyz on, e.g. ':8080'. Disabled if empty.")
+	flag.DurationVar(&maxIdle, "max-idle", 0,
+		"Report unhealthy if no message was received within this duration. Disabled if 0.")
+	mqttConfig := mqttconn.RegisterFlags(MQTTBroker)
+	kafkaConfig = kafkaclient.RegisterFlags()
+	logConfig := logging.RegisterFlags("info")
+	flag.Parse()
+	logConfig.Setup("mqtt_kafka_bridge")
+
+	var errs []error
+	var err error
+	switch direction {
+	case MQTTToKafka:
+		if mqttTopic == "" {
+			mqttTopic = "/weather/+"
+		}
+		if err := mqttconn.ValidateTopicFilter(mqttTopic); err != nil {
+			errs = append(errs, err)
+		}
+	case KafkaToMQTT:
+		if mqttTopic == "" {
+			mqttTopic = "/weather/{key|location}"
+		}
+		if topicTemplate, err = ParseTopicTemplate(mqttTopic); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown direction '%v'", direction))
+	}
+	if key != "none" {
+		level, err := mqttconn.ParseLevel(key)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		keyLevel = &level
+	}
+	if format, err = data.ParseFormat(formatName); err != nil {
+		errs = append(errs, err)
+	}
+	if qos < 0 || qos > 2 {
+		errs = append(errs, fmt.Errorf("invalid QoS level %v, must be 0, 1 or 2", qos))
+	}
+	switch guarantee {
+	case AtLeastOnce:
+		atLeastOnce = true
+		if qos == 0 {
+			errs = append(errs, errors.New("at-least-once delivery requires QoS 1 or 2"))
+		}
+		if clientID == "" {
+			errs = append(errs, errors.New("at-least-once delivery requires a client ID"))
+		}
+	case AtMostOnce:
+	default:
+		errs = append(errs, fmt.Errorf("unknown delivery guarantee '%v'", guarantee))
+	}
+	if err = kafkaConfig.Load(); err != nil {
+		errs = append(errs, err)
+	}
+	if mqttOptions, err = mqttConfig.Options(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "ERROR: %v.\n", err)
+		}
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Only a persistent session keeps unacknowledged messages while the
+	// bridge isn't running.
+	cleanSession = !(atLeastOnce && direction == MQTTToKafka)
+	mqttOptions.SetClientID(clientID)
+	mqttOptions.SetCleanSession(cleanSession)
+}
+
+func main() {
+	var conn *mqttconn.Connection
+	monitor := health.NewMonitor()
+	monitor.AddReadinessCheck("mqtt-broker", func() error {
+		if conn.State() != mqttconn.Connected {
+			return errors.New("not connected to broker")
+		}
+		return nil
+	})
+
+	stop := make(chan struct{})
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-done
+		close(stop)
+	}()
+
+	var err error
+	switch direction {
+	case MQTTToKafka:
+		config := kafka.ConfigMap{}
+		if atLeastOnce {
+			// The idempotent producer avoids duplicates if it retries.
+			config["acks"] = "all"
+			config["enable.idempotence"] = true
+		} else {
+			config["message.send.max.retries"] = 0
+		}
+		var p *kafka.Producer
+		if p, err = kafkaConfig.NewProducer(broker, config); err != nil {
+			logging.Fatal("failed to create producer", "broker", broker, "err", err)
+		}
+		defer p.Close()
+		mqttOptions.SetDefaultPublishHandler(newMQTTHandler(p, stop))
+		conn = mqttconn.NewConnection(mqttOptions, nil)
+		monitor.AddLivenessCheck("last-message", heartbeat.Check(maxIdle))
+		monitor.ListenAndServe(healthAddr)
+		err = runMQTTToKafka(p, conn, stop)
+	case KafkaToMQTT:
+		var c *kafka.Consumer
+		c, err = kafkaConfig.NewConsumer(broker, kafka.ConfigMap{
+			"group.id": group,
+			// Offsets are stored after the message was published.
+			"enable.auto.offset.store": !atLeastOnce,
+		})
+		if err != nil {
+			logging.Fatal("failed to create consumer", "broker", broker, "err", err)
+		}
+		checks := wrapper.AddConsumerChecks(monitor, "kafka", c, maxIdle)
+		defer checks.Close()
+		heartbeat = checks.Heartbeat
+		conn = mqttconn.NewConnection(mqttOptions, nil)
+		monitor.ListenAndServe(healthAddr)
+		err = runKafkaToMQTT(c, conn, stop)
+	}
+	if err != nil && !errors.Is(err, mqttconn.ErrStopped) {
+		logging.Fatal("bridge failed", "direction", direction, "err", err)
+	}
+}
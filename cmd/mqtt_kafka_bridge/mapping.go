@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/mqttconn"
+)
+
+// A HeaderMapping adds a level of the MQTT topic as header to the Kafka
+// message.
+type HeaderMapping struct {
+	Header string
+	Level  mqttconn.Level
+}
+
+// ParseHeaderMapping parses a header mapping of the form '<header>=<level>',
+// e.g. 'location=-1'.
+func ParseHeaderMapping(s string) (HeaderMapping, error) {
+	name, level, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return HeaderMapping{}, fmt.Errorf("invalid header mapping '%v', must be '<header>=<level>'", s)
+	}
+	l, err := mqttconn.ParseLevel(level)
+	if err != nil {
+		return HeaderMapping{}, err
+	}
+	return HeaderMapping{name, l}, nil
+}
+
+func (h HeaderMapping) String() string {
+	return fmt.Sprintf("%v=%v", h.Header, h.Level)
+}
+
+// headerMappings collects the values of the repeatable '-header' flag.
+type headerMappings []HeaderMapping
+
+func (h *headerMappings) String() string {
+	return fmt.Sprint(*h)
+}
+
+func (h *headerMappings) Set(s string) error {
+	m, err := ParseHeaderMapping(s)
+	if err != nil {
+		return err
+	}
+	*h = append(*h, m)
+	return nil
+}
+
+var placeholder = regexp.MustCompile(`\{([^{}|]+)(\|location)?\}`)
+
+// A TopicTemplate builds the MQTT topic of a Kafka message. The placeholders
+// '{key}', '{topic}', '{partition}' and '{header.<name>}' are replaced by
+// the key, topic, partition and header of the message. '|location' converts
+// the value to a location, e.g. '{key|location}' is 'bad-mergentheim' for
+// the key 'Bad Mergentheim'.
+type TopicTemplate string
+
+// ParseTopicTemplate validates the template s.
+func ParseTopicTemplate(s string) (TopicTemplate, error) {
+	if s == "" {
+		return "", fmt.Errorf("the MQTT topic must not be empty")
+	}
+	if strings.ContainsAny(placeholder.ReplaceAllString(s, ""), "+#{}") {
+		return "", fmt.Errorf("invalid MQTT topic '%v': wildcards and unknown placeholders aren't allowed", s)
+	}
+	for _, m := range placeholder.FindAllStringSubmatch(s, -1) {
+		if name := m[1]; name != "key" && name != "topic" && name != "partition" &&
+			!strings.HasPrefix(name, "header.") {
+			return "", fmt.Errorf("invalid MQTT topic '%v': unknown placeholder '%v'", s, name)
+		}
+	}
+	return TopicTemplate(s), nil
+}
+
+// Topic returns the MQTT topic for msg. It fails if a placeholder has no
+// value, e.g. the message has no key, or the value contains wildcards.
+func (t TopicTemplate) Topic(msg *kafka.Message) (string, error) {
+	var err error
+	topic := placeholder.ReplaceAllStringFunc(string(t), func(s string) string {
+		m := placeholder.FindStringSubmatch(s)
+		var value string
+		switch name := m[1]; {
+		case name == "key":
+			value = string(msg.Key)
+		case name == "topic":
+			if msg.TopicPartition.Topic != nil {
+				value = *msg.TopicPartition.Topic
+			}
+		case name == "partition":
+			value = strconv.Itoa(int(msg.TopicPartition.Partition))
+		default:
+			header := strings.TrimPrefix(name, "header.")
+			for _, h := range msg.Headers {
+				if h.Key == header {
+					value = string(h.Value)
+				}
+			}
+		}
+		if m[2] != "" {
+			value = data.Location(value)
+		}
+		if value == "" || strings.ContainsAny(value, "+#") {
+			err = fmt.Errorf("no valid value for placeholder '%v'", s)
+		}
+		return value
+	})
+	return topic, err
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/mqttconn"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/wrapper"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Headers added to each Kafka message forwarded from MQTT.
+const (
+	TopicHeader    = "mqtt-topic"
+	QoSHeader      = "mqtt-qos"
+	RetainedHeader = "mqtt-retained"
+)
+
+// newMQTTHandler returns the handler producing each MQTT message to the Kafka
+// topic.
+//
+// With at-least-once delivery, a message is acknowledged to the MQTT broker
+// only after Kafka confirmed its delivery, so the broker redelivers it to the
+// persistent session if the bridge fails in between. Otherwise messages are
+// produced asynchronously and lost if their delivery fails.
+func newMQTTHandler(p *kafka.Producer, stop <-chan struct{}) mqtt.MessageHandler {
+	logger := slog.With("from", mqttTopic, "to", kafkaTopic)
+
+	// Log failed deliveries of asynchronously produced messages.
+	go func() {
+		for e := range p.Events() {
+			switch ev := e.(type) {
+			case *kafka.Message:
+				if ev.TopicPartition.Error != nil {
+					wrapper.MessageLogger(logger, ev).Error("message not delivered",
+						"err", ev.TopicPartition.Error)
+				}
+			case kafka.Error:
+				logger.Warn("producer error", "err", ev)
+			}
+		}
+	}()
+
+	return func(_ mqtt.Client, msg mqtt.Message) {
+		heartbeat.Beat()
+		kmsg := &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &kafkaTopic, Partition: kafka.PartitionAny},
+			Value:          msg.Payload(),
+			Headers: []kafka.Header{
+				wrapper.ContentTypeHeader(format),
+				{Key: TopicHeader, Value: []byte(msg.Topic())},
+				{Key: QoSHeader, Value: []byte(strconv.Itoa(int(msg.Qos())))},
+				{Key: RetainedHeader, Value: []byte(strconv.FormatBool(msg.Retained()))},
+			},
+		}
+		if keyLevel != nil {
+			if key, ok := keyLevel.Of(msg.Topic()); ok {
+				kmsg.Key = []byte(key)
+			}
+		}
+		for _, h := range headers {
+			if value, ok := h.Level.Of(msg.Topic()); ok {
+				kmsg.Headers = append(kmsg.Headers, kafka.Header{Key: h.Header, Value: []byte(value)})
+			}
+		}
+
+		if !atLeastOnce {
+			if err := p.Produce(kmsg, nil); err != nil {
+				logger.Error("cannot produce message", "mqttTopic", msg.Topic(), "err", err)
+			}
+			return
+		}
+
+		// Wait for the delivery report, the message is acknowledged to the
+		// MQTT broker when the handler returns.
+		delivery := make(chan kafka.Event, 1)
+		for {
+			err := p.Produce(kmsg, delivery)
+			if err == nil {
+				select {
+				case e := <-delivery:
+					err = e.(*kafka.Message).TopicPartition.Error
+				case <-stop:
+					exitUnacknowledged(logger, msg)
+				}
+				if err == nil {
+					return
+				}
+			}
+			logger.Error("message not delivered, retrying", "mqttTopic", msg.Topic(), "err", err)
+			select {
+			case <-stop:
+				exitUnacknowledged(logger, msg)
+			case <-time.After(time.Second):
+			}
+		}
+	}
+
+}
+
+// exitUnacknowledged exits the bridge while the handler of msg is still
+// running, so msg isn't acknowledged and the broker redelivers it to the
+// session after a restart. The handler must not return instead, and a
+// graceful disconnect would wait for it forever.
+func exitUnacknowledged(logger *slog.Logger, msg mqtt.Message) {
+	logger.Error("stopped before the message was delivered, exiting without acknowledging it",
+		"mqttTopic", msg.Topic())
+	os.Exit(1)
+}
+
+// runMQTTToKafka forwards the messages of the MQTT topic filter to the Kafka
+// topic until stop is closed. The default publish handler of c must be the
+// handler returned by newMQTTHandler.
+func runMQTTToKafka(p *kafka.Producer, c *mqttconn.Connection, stop <-chan struct{}) error {
+	logger := slog.With("from", mqttTopic, "to", kafkaTopic)
+	if err := c.Subscribe(mqttTopic, byte(qos), nil); err != nil {
+		return err
+	}
+	if err := c.Connect(stop); err != nil {
+		return err
+	}
+	logger.Info("bridge started", "guarantee", guarantee)
+
+	<-stop
+	if cleanSession {
+		if err := c.Unsubscribe(mqttTopic); err != nil {
+			logger.Error("cannot unsubscribe topic", "err", err)
+		}
+	}
+	c.Disconnect(250)
+	if remaining := p.Flush(5000); remaining > 0 {
+		logger.Warn("messages not delivered on exit", "remaining", remaining)
+	}
+	return nil
+}
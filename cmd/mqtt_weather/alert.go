@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/expr"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// An Alert is raised if the alert condition becomes true for a city.
+type Alert struct {
+	Condition string            `json:"condition"`
+	City      string            `json:"city"`
+	Raised    time.Time         `json:"raised"`
+	Record    *data.WeatherData `json:"record"`
+}
+
+// JSON returns the alert encoded as JSON. Unlike json.Marshal, it doesn't
+// escape '<' and '>', which are common in conditions.
+func (a *Alert) JSON() ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(a); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(b.Bytes(), "\n"), nil
+}
+
+// An Action is executed for each alert.
+type Action interface {
+	Run(a *Alert) error
+}
+
+// A CommandAction runs a shell command for each alert. The alert is passed
+// as JSON on stdin and the fields of the record as environment variables,
+// e.g. WEATHER_CITY and WEATHER_TEMP_CURRENT.
+type CommandAction struct {
+	Command string
+}
+
+// envName converts a field name to the name of its environment variable,
+// e.g. 'tempCurrent' to 'WEATHER_TEMP_CURRENT'.
+func envName(field string) string {
+	var b strings.Builder
+	b.WriteString("WEATHER_")
+	for i, c := range field {
+		if i > 0 && c >= 'A' && c <= 'Z' {
+			b.WriteByte('_')
+		}
+		b.WriteString(strings.ToUpper(string(c)))
+	}
+	return b.String()
+}
+
+func (c *CommandAction) Run(a *Alert) error {
+	payload, err := a.JSON()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("sh", "-c", c.Command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), fmt.Sprintf("WEATHER_ALERT=%v", a.Condition))
+	for _, name := range recordFields {
+		if v, ok := (record{a.Record}).Field(name); ok {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%v=%v", envName(name), v))
+		}
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("alert command failed: %w", err)
+	}
+	return nil
+}
+
+// A PublishAction publishes each alert as JSON to an MQTT topic.
+type PublishAction struct {
+	Client mqtt.Client
+	Topic  string
+}
+
+func (p *PublishAction) Run(a *Alert) error {
+	payload, err := a.JSON()
+	if err != nil {
+		return err
+	}
+	token := p.Client.Publish(p.Topic, 1, false, payload)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("cannot publish alert to topic '%v': %w", p.Topic, err)
+	}
+	return nil
+}
+
+// cityState is the state of a Watcher for a single city.
+type cityState struct {
+	shown    bool
+	lastTemp float64
+	alerting bool
+}
+
+// A Watcher decides which records are shown and raises alerts. It is safe
+// for concurrent use.
+type Watcher struct {
+	// Filter selects the records to show. All records are shown if nil.
+	Filter *expr.Expr
+	// Change is the minimum change of the current temperature in °C since
+	// the last shown record of a city, before a record is shown again.
+	// Disabled if 0.
+	Change float64
+	// Alert is the alert condition. An alert is raised when the condition
+	// becomes true for a city and again only after it was false.
+	Alert   *expr.Expr
+	Actions []Action
+
+	mu     sync.Mutex
+	cities map[string]*cityState
+}
+
+// Handle processes the record w and reports whether it should be shown.
+// Actions of raised alerts are run in the background.
+func (wa *Watcher) Handle(w *data.WeatherData) bool {
+	wa.mu.Lock()
+	defer wa.mu.Unlock()
+	if wa.cities == nil {
+		wa.cities = map[string]*cityState{}
+	}
+	state, ok := wa.cities[w.City]
+	if !ok {
+		state = &cityState{}
+		wa.cities[w.City] = state
+	}
+
+	logger := slog.With("city", w.City)
+	if wa.Alert != nil {
+		alerting, err := wa.Alert.Match(record{w}.Field)
+		if err != nil {
+			logger.Warn("cannot evaluate alert condition", "err", err)
+		}
+		if alerting && !state.alerting {
+			wa.raise(&Alert{Condition: wa.Alert.String(), City: w.City, Raised: time.Now(), Record: w})
+		}
+		state.alerting = alerting
+	}
+
+	if wa.Filter != nil {
+		match, err := wa.Filter.Match(record{w}.Field)
+		if err != nil {
+			logger.Warn("cannot evaluate filter", "err", err)
+		}
+		if !match {
+			return false
+		}
+	}
+	if wa.Change > 0 && state.shown && math.Abs(w.TempCurrent-state.lastTemp) < wa.Change {
+		return false
+	}
+	state.shown = true
+	state.lastTemp = w.TempCurrent
+	return true
+}
+
+// raise runs the actions for the alert a. The actions run in the background,
+// so slow commands don't block the MQTT client.
+func (wa *Watcher) raise(a *Alert) {
+	logger := slog.With("city", a.City, "condition", a.Condition)
+	logger.Warn("alert raised")
+	for _, action := range wa.Actions {
+		go func(action Action) {
+			if err := action.Run(a); err != nil {
+				logger.Error("alert action failed", "err", err)
+			}
+		}(action)
+	}
+}
+
+// Alerting reports whether an alert is currently raised for the city.
+func (wa *Watcher) Alerting(city string) bool {
+	wa.mu.Lock()
+	defer wa.mu.Unlock()
+	state, ok := wa.cities[city]
+	return ok && state.alerting
+}
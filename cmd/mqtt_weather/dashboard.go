@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/mqttconn"
+)
+
+// clearScreen moves the cursor to the top left corner and clears the
+// terminal.
+const clearScreen = "\033[H\033[2J"
+
+const dashboardRow = "%-18s  %9s  %9s  %9s  %9s  %6s  %8s  %5s\n"
+
+// dashboardEntry is the state of a single city on the dashboard.
+type dashboardEntry struct {
+	record   *data.WeatherData
+	previous float64
+	received time.Time
+	count    int
+}
+
+// A Dashboard is a Printer which keeps the latest record of each city and
+// renders all cities as table, which is refreshed periodically. It is safe
+// for concurrent use.
+type Dashboard struct {
+	Unit   data.Unit
+	Topics []string
+	// Alerting reports whether an alert is raised for a city. May be nil.
+	Alerting func(city string) bool
+	// State returns the state of the connection to the broker, which is
+	// shown unless connected. May be nil.
+	State func() mqttconn.State
+
+	mu     sync.Mutex
+	cities map[string]*dashboardEntry
+}
+
+func (d *Dashboard) Print(w *data.WeatherData) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cities == nil {
+		d.cities = map[string]*dashboardEntry{}
+	}
+	entry, ok := d.cities[w.City]
+	if !ok {
+		entry = &dashboardEntry{}
+		d.cities[w.City] = entry
+	} else {
+		entry.previous = entry.record.TempCurrent
+	}
+	entry.record = w
+	entry.received = time.Now()
+	entry.count++
+	return nil
+}
+
+// Render writes the dashboard to out, preceded by the escape sequence to
+// clear the terminal.
+func (d *Dashboard) Render(out io.Writer, now time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	fmt.Fprintf(&b, "Weather of %v at %v", strings.Join(d.Topics, ", "),
+		now.Format(time.TimeOnly))
+	if d.State != nil {
+		if state := d.State(); state != mqttconn.Connected {
+			fmt.Fprintf(&b, " (%v)", state)
+		}
+	}
+	b.WriteString("\n\n")
+	if len(d.cities) == 0 {
+		b.WriteString("Waiting for weather data...\n")
+		_, err := io.WriteString(out, b.String())
+		return err
+	}
+
+	s := d.Unit.Symbol()
+	fmt.Fprintf(&b, dashboardRow, "CITY", "CUR "+s, "MIN "+s, "MAX "+s, "FEELS "+s,
+		"TREND", "UPDATED", "ALERT")
+	cities := make([]string, 0, len(d.cities))
+	for city := range d.cities {
+		cities = append(cities, city)
+	}
+	sort.Strings(cities)
+
+	temp := func(c float64) string {
+		return strconv.FormatFloat(math.Round(d.Unit.FromCelsius(c)*10)/10, 'f', 1, 64)
+	}
+	for _, city := range cities {
+		entry := d.cities[city]
+		w := entry.record
+		trend := "="
+		switch {
+		case entry.count == 1:
+			trend = ""
+		case w.TempCurrent > entry.previous:
+			trend = "↑"
+		case w.TempCurrent < entry.previous:
+			trend = "↓"
+		}
+		alert := ""
+		if d.Alerting != nil && d.Alerting(city) {
+			alert = "!"
+		}
+		fmt.Fprintf(&b, dashboardRow, city, temp(w.TempCurrent), temp(w.TempMin),
+			temp(w.TempMax), temp(w.FeelsLike()), trend,
+			now.Sub(entry.received).Truncate(time.Second).String(), alert)
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// Run renders the dashboard to out every interval until stop is closed.
+func (d *Dashboard) Run(out io.Writer, interval time.Duration, stop <-chan struct{}) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := d.Render(out, time.Now()); err != nil {
+			return err
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
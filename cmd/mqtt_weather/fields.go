@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/expr"
+)
+
+// recordFields are the names of the fields returned by record.Field.
+var recordFields = []string{"tempCurrent", "tempMax", "tempMin", "feelsLike",
+	"dewPoint", "humidity", "pressure", "windSpeed", "windDirection", "comment",
+	"city", "cityId"}
+
+// recordTypes returns the types of the fields returned by record.Field, to
+// compile filters and alert conditions with expr.Compile.
+func recordTypes() map[string]expr.Type {
+	types := map[string]expr.Type{}
+	for _, name := range recordFields {
+		types[name] = expr.Number
+	}
+	types["comment"] = expr.String
+	types["city"] = expr.String
+	return types
+}
+
+// A record exposes the fields of a weather record to expressions and alert
+// commands.
+type record struct {
+	*data.WeatherData
+}
+
+// Field returns the value of the field name of the record, using the names
+// of the wire format and the derived values 'feelsLike' and 'dewPoint'.
+// Numbers are float64, temperatures are in Celsius.
+// ok is false if the field is unknown or an optional value is missing.
+func (r record) Field(name string) (v any, ok bool) {
+	optional := func(v *float64) (any, bool) {
+		if v == nil {
+			return nil, false
+		}
+		return *v, true
+	}
+	switch name {
+	case "tempCurrent":
+		return r.TempCurrent, true
+	case "tempMax":
+		return r.TempMax, true
+	case "tempMin":
+		return r.TempMin, true
+	case "feelsLike":
+		return r.FeelsLike(), true
+	case "dewPoint":
+		if dewPoint, ok := r.DewPoint(); ok {
+			return dewPoint, true
+		}
+		return nil, false
+	case "humidity":
+		return optional(r.Humidity)
+	case "pressure":
+		return optional(r.Pressure)
+	case "windSpeed":
+		return optional(r.WindSpeed)
+	case "windDirection":
+		return optional(r.WindDirection)
+	case "comment":
+		return r.Comment, true
+	case "city":
+		return r.City, true
+	case "cityId":
+		return float64(r.CityID), true
+	}
+	return nil, false
+}
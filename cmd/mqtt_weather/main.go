@@ -1,79 +1,235 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/expr"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/mqttconn"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/output"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 const (
-	Host            = "10.50.12.150"
-	Port            = 1883
-	TimestampFormat = "2006-01-02T15:04:05.000-07:00"
+	Broker = "tcp://10.50.12.150:1883"
 )
 
 var (
-	topic string
+	topics   []string
+	opts     *mqtt.ClientOptions
+	brokers  string
+	logger   *slog.Logger
+	registry schema.Registry
+	format   data.Format
+	printer  output.Printer
+	watcher  Watcher
+
+	dashboard *Dashboard
+	refresh   time.Duration
+
+	alertCommand string
+	alertTopic   string
+
+	qos          int
+	clientID     string
+	cleanSession bool
+	retained     bool
+	storeDir     string
 )
 
 // f handles an incoming message over the MQTT protocol
 var f mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
-	var w data.WeatherData
-	if err := json.Unmarshal(msg.Payload(), &w); err != nil {
-		fmt.Fprintf(os.Stderr, "Error while receiving data: %v", err)
-	} else {
-		fmt.Println(w)
+	if msg.Retained() && !retained {
+		logger.Debug("ignoring retained message", "topic", msg.Topic())
+		return
+	}
+	w, err := format.DecodeWeatherData(registry, msg.Payload())
+	if err != nil {
+		logger.Warn("error while receiving data", "topic", msg.Topic(),
+			"payload", string(msg.Payload()), "err", err)
+	} else if watcher.Handle(w) {
+		if err := printer.Print(w); err != nil {
+			logging.Fatal("cannot print weather data", "err", err)
+		}
 	}
 }
 
 // init initializes all neccessary global variables, e.g. from the command line
 // interface.
 func init() {
-	var location string
-	flag.StringVar(&location, "l", "", "Location for weather data.")
+	var location, formatName, filter, alert string
+	var showDashboard bool
+	flag.StringVar(&location, "l", "",
+		"Comma separated list of locations for weather data, '+' or '#' for all locations.")
+	flag.StringVar(&formatName, "payload-format", string(data.FormatJSON),
+		"Format of the payloads, 'json', 'protobuf' or 'avro'.")
+	flag.StringVar(&filter, "filter", "",
+		"Only show records matching this expression, e.g. 'tempCurrent > 30 || tempMin < 0'.")
+	flag.Float64Var(&watcher.Change, "change", 0,
+		"Only show a record if the current temperature changed by at least this value in °C.")
+	flag.StringVar(&alert, "alert", "", "Raise an alert when this expression becomes true.")
+	flag.StringVar(&alertCommand, "alert-exec", "", "Shell command to run for each alert.")
+	flag.StringVar(&alertTopic, "alert-topic", "", "MQTT topic to publish each alert to.")
+	flag.IntVar(&qos, "qos", 0, "QoS level of the subscriptions, 0, 1 or 2.")
+	flag.StringVar(&clientID, "client-id", "",
+		"MQTT client ID, required for a persistent session. Assigned by the broker if empty.")
+	flag.BoolVar(&cleanSession, "clean-session", true,
+		"Start a new session on connect. Disable to receive the messages sent while offline.")
+	flag.BoolVar(&retained, "retained", true,
+		"Show the retained message of each topic, i.e. the last known value, on start.")
+	flag.StringVar(&storeDir, "store", "",
+		"Directory to store in-flight QoS 1 and 2 messages in. In memory if empty.")
+	flag.BoolVar(&showDashboard, "dashboard", false,
+		"Show a continuously refreshing dashboard of all cities instead of the records.")
+	flag.DurationVar(&refresh, "refresh", time.Second, "Refresh interval of the dashboard.")
+	mqttConfig := mqttconn.RegisterFlags(Broker)
+	outputConfig := output.RegisterFlags()
+	registryLocation := schema.RegisterFlag()
+	logConfig := logging.RegisterFlags("warn")
 	flag.Parse()
 
-	if location == "" {
-		fmt.Fprintln(os.Stderr, "ERROR: you must specify a location.")
+	var errs []error
+	var err error
+	brokers = mqttConfig.Brokers
+	if opts, err = mqttConfig.Options(); err != nil {
+		errs = append(errs, err)
+	}
+	if topics, err = parseTopics(location); err != nil {
+		errs = append(errs, err)
+	}
+	if format, err = data.ParseFormat(formatName); err != nil {
+		errs = append(errs, err)
+	}
+	if filter != "" {
+		if watcher.Filter, err = expr.Compile(filter, recordTypes()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if alert != "" {
+		if watcher.Alert, err = expr.Compile(alert, recordTypes()); err != nil {
+			errs = append(errs, err)
+		}
+	} else if alertCommand != "" || alertTopic != "" {
+		errs = append(errs, errors.New("alert actions require an alert condition"))
+	}
+	if watcher.Change < 0 {
+		errs = append(errs, errors.New("the change threshold must not be negative"))
+	}
+	if qos < 0 || qos > 2 {
+		errs = append(errs, fmt.Errorf("invalid QoS level %v, must be 0, 1 or 2", qos))
+	}
+	if !cleanSession && clientID == "" {
+		errs = append(errs, errors.New("a persistent session requires a client ID"))
+	}
+	if showDashboard {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "output" || f.Name == "template" {
+				errs = append(errs, fmt.Errorf("the dashboard can't be combined with '-%v'", f.Name))
+			}
+		})
+		if refresh <= 0 {
+			errs = append(errs, errors.New("the refresh interval must be positive"))
+		}
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "ERROR: %v.\n", err)
+		}
 		flag.Usage()
 		os.Exit(1)
 	}
-	// Generate a topic from the location
-	topic = fmt.Sprintf("/weather/%s", location)
+	printer = outputConfig.Setup()
+	if showDashboard {
+		// The unit is already validated by Setup.
+		unit, _ := data.ParseUnit(outputConfig.Unit)
+		dashboard = &Dashboard{Unit: unit, Topics: topics, Alerting: watcher.Alerting}
+		printer = dashboard
+	}
+	logger = logConfig.Setup("mqtt_weather").With("topics", topics)
+
+	if registry, err = schema.Open(*registryLocation); err != nil {
+		logging.Fatal("cannot open schema registry", "err", err)
+	}
+	if alertCommand != "" {
+		watcher.Actions = append(watcher.Actions, &CommandAction{Command: alertCommand})
+	}
 }
 
 func main() {
 	// Set client options
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(fmt.Sprintf("tcp://%v:%v", Host, Port))
 	opts.SetDefaultPublishHandler(f)
-
-	c := mqtt.NewClient(opts)
-	if token := c.Connect(); token.Wait() && token.Error() != nil {
-		fmt.Println(token.Error())
-		os.Exit(1)
+	opts.SetClientID(clientID)
+	opts.SetCleanSession(cleanSession)
+	if storeDir != "" {
+		// The store is created only after all flags are valid.
+		if err := os.MkdirAll(storeDir, 0o770); err != nil {
+			logging.Fatal("cannot create store directory", "dir", storeDir, "err", err)
+		}
+		opts.SetStore(mqtt.NewFileStore(storeDir))
 	}
 
-	// Subscribe topic
-	if token := c.Subscribe(topic, 0, nil); token.Wait() && token.Error() != nil {
-		fmt.Println(token.Error())
-		os.Exit(1)
+	// The connection reconnects automatically and subscribes the topics on
+	// each connect.
+	c := mqttconn.NewConnection(opts, nil)
+	for _, topic := range topics {
+		if err := c.Subscribe(topic, byte(qos), nil); err != nil {
+			logging.Fatal("cannot subscribe topic", "topic", topic, "err", err)
+		}
+	}
+	if alertTopic != "" {
+		watcher.Actions = append(watcher.Actions, &PublishAction{Client: c.Client, Topic: alertTopic})
 	}
 
-	// Wait for kill and clean up
+	// Stop on kill
+	stop := make(chan struct{})
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
-	<-done
+	go func() {
+		<-done
+		close(stop)
+	}()
 
-	if token := c.Unsubscribe(topic); token.Wait() && token.Error() != nil {
-		fmt.Println(token.Error())
-		os.Exit(1)
+	rendered := make(chan struct{})
+	if dashboard != nil {
+		dashboard.State = c.State
+		go func() {
+			defer close(rendered)
+			if err := dashboard.Run(os.Stdout, refresh, stop); err != nil {
+				logging.Fatal("cannot render dashboard", "err", err)
+			}
+		}()
+	} else {
+		close(rendered)
+	}
+
+	if !cleanSession {
+		logger.Info("using persistent session", "clientId", clientID)
+	}
+	if err := c.Connect(stop); err != nil {
+		<-rendered
+		return
+	}
+	logger.Info("connected, waiting for weather data", "brokers", brokers)
+
+	// Wait for kill and clean up
+	<-stop
+	<-rendered
+
+	// Keep the subscriptions of a persistent session, so the broker queues
+	// the messages until the next start.
+	if cleanSession {
+		if err := c.Unsubscribe(topics...); err != nil {
+			logger.Error("cannot unsubscribe topics", "err", err)
+		}
 	}
 
 	c.Disconnect(250)
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/mqttconn"
+)
+
+// TopicPrefix is the prefix of the weather topics, followed by the location.
+const TopicPrefix = "/weather/"
+
+// parseTopics converts a comma separated list of locations to the topic
+// filters to subscribe, e.g. 'mosbach,+' to '/weather/mosbach' and
+// '/weather/+'. Locations may be the MQTT wildcards '+' and '#'. Locations
+// starting with '/' are used as topic filter as is.
+func parseTopics(locations string) ([]string, error) {
+	var topics []string
+	seen := map[string]bool{}
+	for _, location := range strings.Split(locations, ",") {
+		location = strings.TrimSpace(location)
+		if location == "" {
+			continue
+		}
+		topic := location
+		if !strings.HasPrefix(location, "/") {
+			topic = TopicPrefix + location
+		}
+		if err := mqttconn.ValidateTopicFilter(topic); err != nil {
+			return nil, err
+		}
+		if !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("you must specify a location")
+	}
+	return topics, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+)
+
+const (
+	KafkaBroker = "10.50.15.52"
+	MQTTBroker  = "tcp://10.50.12.150:1883"
+)
+
+// A Header is a Kafka message header.
+type Header struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// A Record is a captured message. Records are stored as one JSON object per
+// line, keys and values are base64 encoded.
+type Record struct {
+	// Source is the messaging system the message was captured from, either
+	// 'kafka' or 'mqtt'.
+	Source    string   `json:"source"`
+	Topic     string   `json:"topic"`
+	Partition int32    `json:"partition,omitempty"`
+	Offset    int64    `json:"offset,omitempty"`
+	Key       []byte   `json:"key,omitempty"`
+	Value     []byte   `json:"value"`
+	Headers   []Header `json:"headers,omitempty"`
+	QoS       byte     `json:"qos,omitempty"`
+	Retained  bool     `json:"retained,omitempty"`
+	// Timestamp is the timestamp of the Kafka message, if available.
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	// Received is the time the message was captured. It is used to
+	// reproduce the timing on replay.
+	Received time.Time `json:"received"`
+}
+
+// A RecordWriter writes records to a file.
+type RecordWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewRecordWriter(w io.Writer) *RecordWriter {
+	b := bufio.NewWriter(w)
+	return &RecordWriter{b, json.NewEncoder(b)}
+}
+
+func (r *RecordWriter) Write(rec *Record) error {
+	if err := r.enc.Encode(rec); err != nil {
+		return err
+	}
+	// Flush after each record, so the file is complete if the application
+	// is killed.
+	return r.w.Flush()
+}
+
+// A RecordReader reads records from a file.
+type RecordReader struct {
+	dec *json.Decoder
+}
+
+func NewRecordReader(r io.Reader) *RecordReader {
+	return &RecordReader{json.NewDecoder(bufio.NewReader(r))}
+}
+
+// Read reads the next record. It returns io.EOF if no records are left.
+func (r *RecordReader) Read() (*Record, error) {
+	var rec Record
+	if err := r.dec.Decode(&rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: %v <command> [flags]
+
+Commands:
+  record   capture messages from Kafka or MQTT into a file
+  replay   replay messages from a file into Kafka or MQTT
+
+Run '%v <command> -h' for the flags of a command.
+`, os.Args[0], os.Args[0])
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	// The logging flags are registered on the default flag set, so use it
+	// for the subcommands.
+	flag.CommandLine = fs
+	logConfig := logging.RegisterFlags("info")
+
+	var run func() error
+	switch os.Args[1] {
+	case "record":
+		run = recordCommand(fs)
+	case "replay":
+		run = replayCommand(fs)
+	case "-h", "-help", "--help", "help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "ERROR: unknown command '%v'.\n", os.Args[1])
+		usage()
+		os.Exit(1)
+	}
+
+	fs.Parse(os.Args[2:])
+	logConfig.Setup("msgrecord")
+	if err := run(); err != nil {
+		logging.Fatal(fmt.Sprintf("%v failed", os.Args[1]), "err", err)
+	}
+}
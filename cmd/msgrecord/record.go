@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/kafkaclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+)
+
+type recordOptions struct {
+	from     string
+	broker   string
+	topic    string
+	group    string
+	offset   string
+	output   string
+	count    int
+	duration time.Duration
+	kafka    *kafkaclient.Config
+}
+
+// recordCommand registers the flags of the record command on fs and returns
+// the function running it.
+func recordCommand(fs *flag.FlagSet) func() error {
+	var o recordOptions
+	fs.StringVar(&o.from, "from", "kafka", "Source to capture from, 'kafka' or 'mqtt'.")
+	fs.StringVar(&o.broker, "broker", "",
+		fmt.Sprintf("Broker to connect to, defaults to '%v' or '%v'.", KafkaBroker, MQTTBroker))
+	fs.StringVar(&o.topic, "topic", "", "Kafka topic or MQTT topic filter to capture.")
+	fs.StringVar(&o.group, "group", "", "Kafka consumer group. Defaults to a random group.")
+	fs.StringVar(&o.offset, "offset", "end",
+		"Kafka offset to start from if the group has no committed offset, 'beginning' or 'end'.")
+	fs.StringVar(&o.output, "o", "-", "File to write the records to, '-' for stdout.")
+	fs.IntVar(&o.count, "n", 0, "Stop after this number of messages. Unlimited if 0.")
+	fs.DurationVar(&o.duration, "d", 0, "Stop after this duration. Unlimited if 0.")
+	o.kafka = kafkaclient.RegisterFlagSet(fs)
+
+	return func() error {
+		if o.topic == "" {
+			return errors.New("you must specify a topic")
+		}
+
+		out := os.Stdout
+		if o.output != "-" {
+			f, err := os.Create(o.output)
+			if err != nil {
+				return fmt.Errorf("cannot create output file: %w", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		w := NewRecordWriter(out)
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		var timeout <-chan time.Time
+		if o.duration > 0 {
+			timeout = time.After(o.duration)
+		}
+
+		switch o.from {
+		case "kafka":
+			if o.broker == "" {
+				o.broker = KafkaBroker
+			}
+			if err := o.kafka.Load(); err != nil {
+				return err
+			}
+			return recordKafka(o, w, stop, timeout)
+		case "mqtt":
+			if o.broker == "" {
+				o.broker = MQTTBroker
+			}
+			return recordMQTT(o, w, stop, timeout)
+		}
+		return fmt.Errorf("unknown source '%v'", o.from)
+	}
+}
+
+func recordKafka(o recordOptions, w *RecordWriter, stop <-chan os.Signal, timeout <-chan time.Time) error {
+	if o.group == "" {
+		// Use a random group, so the recording doesn't take messages away
+		// from other consumers.
+		o.group = fmt.Sprintf("msgrecord-%v", uuid.NewString())
+	}
+	if o.offset != "beginning" && o.offset != "end" {
+		return fmt.Errorf("unknown offset '%v'", o.offset)
+	}
+
+	c, err := o.kafka.NewConsumer(o.broker, kafka.ConfigMap{
+		"group.id":          o.group,
+		"auto.offset.reset": o.offset,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consumer: %w", err)
+	}
+	defer c.Close()
+
+	if err := c.Subscribe(o.topic, nil); err != nil {
+		return fmt.Errorf("failed to subscribe topic '%v': %w", o.topic, err)
+	}
+	logger := slog.With("broker", o.broker, "topic", o.topic, "group", o.group)
+	logger.Info("recording messages")
+
+	recorded := 0
+	for o.count == 0 || recorded < o.count {
+		select {
+		case <-stop:
+			return nil
+		case <-timeout:
+			return nil
+		default:
+		}
+
+		msg, err := c.ReadMessage(100 * time.Millisecond)
+		if err != nil {
+			// Ignore the timout error.
+			if err.(kafka.Error).Code() == kafka.ErrTimedOut {
+				continue
+			}
+			// The client will automatically try to recover from all errors.
+			logger.Error("consumer error", "err", err)
+			continue
+		}
+
+		rec := &Record{
+			Source:    "kafka",
+			Topic:     *msg.TopicPartition.Topic,
+			Partition: msg.TopicPartition.Partition,
+			Offset:    int64(msg.TopicPartition.Offset),
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Timestamp: msg.Timestamp,
+			Received:  time.Now(),
+		}
+		for _, h := range msg.Headers {
+			rec.Headers = append(rec.Headers, Header{h.Key, h.Value})
+		}
+		if err := w.Write(rec); err != nil {
+			return fmt.Errorf("cannot write record: %w", err)
+		}
+		recorded++
+	}
+	logger.Info("recording finished", "recorded", recorded)
+	return nil
+}
+
+func recordMQTT(o recordOptions, w *RecordWriter, stop <-chan os.Signal, timeout <-chan time.Time) error {
+	// The messages are handled in the main goroutine, so the writer isn't
+	// used concurrently.
+	messages := make(chan mqtt.Message, 100)
+	opts := mqtt.NewClientOptions().AddBroker(o.broker)
+	c := mqtt.NewClient(opts)
+	if token := c.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("cannot connect to broker '%v': %w", o.broker, token.Error())
+	}
+	defer c.Disconnect(250)
+
+	// done is closed when the recording ends, so a handler doesn't block
+	// on the full channel. Otherwise the disconnect waits for it forever.
+	done := make(chan struct{})
+	handler := func(client mqtt.Client, msg mqtt.Message) {
+		select {
+		case messages <- msg:
+		case <-done:
+		}
+	}
+	if token := c.Subscribe(o.topic, 1, handler); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("cannot subscribe topic '%v': %w", o.topic, token.Error())
+	}
+	logger := slog.With("broker", o.broker, "topic", o.topic)
+	// Runs before the disconnect.
+	defer func() {
+		close(done)
+		if token := c.Unsubscribe(o.topic); token.WaitTimeout(time.Second) && token.Error() != nil {
+			logger.Error("cannot unsubscribe topic", "err", token.Error())
+		}
+	}()
+	logger.Info("recording messages")
+
+	recorded := 0
+	for o.count == 0 || recorded < o.count {
+		select {
+		case <-stop:
+			return nil
+		case <-timeout:
+			return nil
+		case msg := <-messages:
+			rec := &Record{
+				Source:   "mqtt",
+				Topic:    msg.Topic(),
+				Value:    msg.Payload(),
+				QoS:      msg.Qos(),
+				Retained: msg.Retained(),
+				Received: time.Now(),
+			}
+			if err := w.Write(rec); err != nil {
+				return fmt.Errorf("cannot write record: %w", err)
+			}
+			recorded++
+		}
+	}
+	logger.Info("recording finished", "recorded", recorded)
+	return nil
+}
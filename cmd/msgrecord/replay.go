@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/kafkaclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type replayOptions struct {
+	to            string
+	broker        string
+	topic         string
+	input         string
+	speed         float64
+	keepPartition bool
+	keepTimestamp bool
+	qos           int
+	kafka         *kafkaclient.Config
+}
+
+// A Sink publishes replayed records to a messaging system.
+type Sink interface {
+	Publish(rec *Record) error
+	Close() error
+}
+
+// replayCommand registers the flags of the replay command on fs and returns
+// the function running it.
+func replayCommand(fs *flag.FlagSet) func() error {
+	var o replayOptions
+	fs.StringVar(&o.to, "to", "kafka", "Target to replay to, 'kafka' or 'mqtt'.")
+	fs.StringVar(&o.broker, "broker", "",
+		fmt.Sprintf("Broker to connect to, defaults to '%v' or '%v'.", KafkaBroker, MQTTBroker))
+	fs.StringVar(&o.topic, "topic", "",
+		"Topic to replay to. Defaults to the recorded topic of each message.")
+	fs.StringVar(&o.input, "i", "-", "File to read the records from, '-' for stdin.")
+	fs.Float64Var(&o.speed, "speed", 1,
+		"Replay speed relative to the recording, e.g. 10 replays ten times faster. As fast as possible if 0.")
+	fs.BoolVar(&o.keepPartition, "keep-partition", false,
+		"Replay Kafka messages to their recorded partition.")
+	fs.BoolVar(&o.keepTimestamp, "keep-timestamp", true,
+		"Replay Kafka messages with their recorded timestamp, so consumers see the same timestamps as in the recording.")
+	fs.IntVar(&o.qos, "qos", -1, "MQTT QoS level. Defaults to the recorded QoS level.")
+	o.kafka = kafkaclient.RegisterFlagSet(fs)
+
+	return func() error {
+		if o.speed < 0 {
+			return errors.New("speed must not be negative")
+		}
+
+		in := os.Stdin
+		if o.input != "-" {
+			f, err := os.Open(o.input)
+			if err != nil {
+				return fmt.Errorf("cannot open input file: %w", err)
+			}
+			defer f.Close()
+			in = f
+		}
+		r := NewRecordReader(in)
+
+		var sink Sink
+		var err error
+		switch o.to {
+		case "kafka":
+			if o.broker == "" {
+				o.broker = KafkaBroker
+			}
+			if err = o.kafka.Load(); err != nil {
+				return err
+			}
+			sink, err = newKafkaSink(o)
+		case "mqtt":
+			if o.broker == "" {
+				o.broker = MQTTBroker
+			}
+			sink, err = newMQTTSink(o)
+		default:
+			err = fmt.Errorf("unknown target '%v'", o.to)
+		}
+		if err != nil {
+			return err
+		}
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		if err := replay(o, r, sink, stop); err != nil {
+			sink.Close()
+			return err
+		}
+		return sink.Close()
+	}
+}
+
+// replay publishes all records read from r to sink. The time between two
+// records is the recorded time between them divided by the speed.
+func replay(o replayOptions, r *RecordReader, sink Sink, stop <-chan os.Signal) error {
+	logger := slog.With("to", o.to, "broker", o.broker)
+	logger.Info("replaying messages", "speed", o.speed)
+
+	var first time.Time
+	start := time.Now()
+	replayed := 0
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read record: %w", err)
+		}
+
+		if first.IsZero() {
+			first = rec.Received
+		}
+		if o.speed > 0 {
+			offset := time.Duration(float64(rec.Received.Sub(first)) / o.speed)
+			select {
+			case <-stop:
+				return nil
+			case <-time.After(time.Until(start.Add(offset))):
+			}
+		} else {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+		}
+
+		if err := sink.Publish(rec); err != nil {
+			logger.Error("cannot replay message", "topic", rec.Topic, "err", err)
+			continue
+		}
+		replayed++
+	}
+	logger.Info("replay finished", "replayed", replayed)
+	return nil
+}
+
+type kafkaSink struct {
+	o replayOptions
+	p *kafka.Producer
+}
+
+func newKafkaSink(o replayOptions) (*kafkaSink, error) {
+	p, err := o.kafka.NewProducer(o.broker, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create producer: %w", err)
+	}
+
+	// Log failed deliveries, which are reported on the events channel.
+	go func() {
+		for e := range p.Events() {
+			if msg, ok := e.(*kafka.Message); ok && msg.TopicPartition.Error != nil {
+				slog.Error("message not delivered", "topic", *msg.TopicPartition.Topic,
+					"err", msg.TopicPartition.Error)
+			}
+		}
+	}()
+	return &kafkaSink{o, p}, nil
+}
+
+func (k *kafkaSink) Publish(rec *Record) error {
+	topic := k.o.topic
+	if topic == "" {
+		if rec.Source != "kafka" {
+			return errors.New("records from mqtt require a topic to replay to kafka")
+		}
+		topic = rec.Topic
+	}
+
+	partition := kafka.PartitionAny
+	if k.o.keepPartition && rec.Source == "kafka" {
+		partition = rec.Partition
+	}
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition},
+		Key:            rec.Key,
+		Value:          rec.Value,
+	}
+	// Records from MQTT have no timestamp, they get the time of the replay.
+	if k.o.keepTimestamp && !rec.Timestamp.IsZero() {
+		msg.Timestamp = rec.Timestamp
+	}
+	for _, h := range rec.Headers {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: h.Key, Value: h.Value})
+	}
+	return k.p.Produce(msg, nil)
+}
+
+func (k *kafkaSink) Close() error {
+	remaining := k.p.Flush(10000)
+	k.p.Close()
+	if remaining > 0 {
+		return fmt.Errorf("%v messages not delivered", remaining)
+	}
+	return nil
+}
+
+type mqttSink struct {
+	o replayOptions
+	c mqtt.Client
+}
+
+func newMQTTSink(o replayOptions) (*mqttSink, error) {
+	if o.qos < -1 || o.qos > 2 {
+		return nil, fmt.Errorf("invalid QoS level %v", o.qos)
+	}
+
+	c := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(o.broker))
+	if token := c.Connect(); token.Wait() && token.Error() != nil {
+		return nil, fmt.Errorf("cannot connect to broker '%v': %w", o.broker, token.Error())
+	}
+	return &mqttSink{o, c}, nil
+}
+
+func (m *mqttSink) Publish(rec *Record) error {
+	topic := m.o.topic
+	if topic == "" {
+		if rec.Source != "mqtt" {
+			return errors.New("records from kafka require a topic to replay to mqtt")
+		}
+		topic = rec.Topic
+	}
+
+	qos := rec.QoS
+	if m.o.qos >= 0 {
+		qos = byte(m.o.qos)
+	}
+	token := m.c.Publish(topic, qos, rec.Retained, rec.Value)
+	token.Wait()
+	return token.Error()
+}
+
+func (m *mqttSink) Close() error {
+	m.c.Disconnect(250)
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/kafkaclient"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/throttle"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/wrapper"
+)
+
+const (
+	Broker = "10.50.15.52"
+	// The tankerkoenig topic has a partition for each post code range (0-9).
+	PostCodes = 10
+)
+
+var (
+	broker    string
+	topic     = "tankerkoenig"
+	stations  int
+	rate      float64
+	interval  time.Duration
+	count     int64
+	duration  time.Duration
+	speed     float64
+	seed      int64
+	malformed float64
+	dynamics  PriceDynamics
+	registry  schema.Registry
+
+	kafkaConfig *kafkaclient.Config
+)
+
+// init initializes all neccessary global variables, e.g. from the command line
+// interface.
+func init() {
+	flag.StringVar(&broker, "broker", Broker, "Kafka bootstrap servers.")
+	flag.StringVar(&topic, "t", topic, "Topic to produce to.")
+	flag.IntVar(&stations, "stations", 5000, "Number of simulated stations.")
+	flag.Float64Var(&rate, "rate", 100, "Number of price updates per second.")
+	flag.Int64Var(&count, "n", 0, "Total number of records to produce. Unlimited if 0.")
+	flag.DurationVar(&duration, "d", 0, "Duration to produce records for. Unlimited if 0.")
+	flag.Float64Var(&speed, "speed", 1,
+		"Speed of the simulated time, e.g. 60 simulates a minute each second.")
+	flag.Int64Var(&seed, "seed", time.Now().UnixNano(), "Seed of the random generator.")
+	flag.Float64Var(&malformed, "malformed", 0,
+		"Probability of a malformed record, between 0 and 1.")
+	flag.Float64Var(&dynamics.Diesel, "diesel", 1.75, "Base price of diesel in €.")
+	flag.Float64Var(&dynamics.E5, "e5", 1.85, "Base price of E5 in €.")
+	flag.Float64Var(&dynamics.E10, "e10", 1.79, "Base price of E10 in €.")
+	flag.Float64Var(&dynamics.Spread, "spread", 0.03,
+		"Standard deviation of the price offset between stations in €.")
+	flag.Float64Var(&dynamics.Volatility, "volatility", 0.005,
+		"Standard deviation of the price change per update in €.")
+	flag.Float64Var(&dynamics.Daily, "daily", 0.04,
+		"Amplitude of the daily price cycle in €.")
+	registryLocation := schema.RegisterFlag()
+	kafkaConfig = kafkaclient.RegisterFlags()
+	logConfig := logging.RegisterFlags("info")
+	flag.Parse()
+	logConfig.Setup("tankerkoenig_simulator")
+	kafkaConfig.Setup()
+
+	if stations < 1 || rate <= 0 || speed <= 0 || count < 0 || duration < 0 ||
+		malformed < 0 || malformed > 1 {
+		fmt.Fprintln(os.Stderr, "ERROR: invalid arguments.")
+		flag.Usage()
+		os.Exit(1)
+	}
+	var err error
+	if interval, err = throttle.Interval(rate); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v.\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if registry, err = schema.Open(*registryLocation); err != nil {
+		logging.Fatal("cannot open schema registry", "err", err)
+	}
+}
+
+// partition returns the partition for a post code, which is its first digit.
+func partition(postCode string) int32 {
+	if postCode == "" || postCode[0] < '0' || postCode[0] > '9' {
+		return kafka.PartitionAny
+	}
+	return int32(postCode[0]-'0') % PostCodes
+}
+
+func main() {
+	p, err := kafkaConfig.NewProducer(broker, nil)
+	if err != nil {
+		logging.Fatal("failed to create producer", "broker", broker, "err", err)
+	}
+	defer p.Close()
+
+	// Count delivered and failed records, which are reported on the events
+	// channel.
+	var delivered, failed atomic.Int64
+	go func() {
+		for e := range p.Events() {
+			switch ev := e.(type) {
+			case *kafka.Message:
+				if ev.TopicPartition.Error != nil {
+					failed.Add(1)
+					wrapper.MessageLogger(slog.Default(), ev).Error(
+						"record not delivered", "err", ev.TopicPartition.Error)
+				} else {
+					delivered.Add(1)
+				}
+			case kafka.Error:
+				slog.Warn("producer error", "broker", broker, "err", ev)
+			}
+		}
+	}()
+
+	r := rand.New(rand.NewSource(seed))
+	sim := NewSimulator(stations, dynamics, r)
+
+	// The simulated time starts now and runs speed times faster.
+	start := time.Now()
+	simTime := func() time.Time {
+		return start.Add(time.Duration(float64(time.Since(start)) * speed))
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	var timeout <-chan time.Time
+	if duration > 0 {
+		timeout = time.After(duration)
+	}
+
+	slog.Info("simulating tankerkoenig records", "broker", broker, "topic", topic,
+		"stations", stations, "rate", rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var produced, invalid int64
+	for run := true; run && (count == 0 || produced < count); {
+		select {
+		case <-stop:
+			run = false
+			continue
+		case <-timeout:
+			run = false
+			continue
+		case <-ticker.C:
+		}
+
+		entry := sim.Next(simTime())
+		value, err := data.EncodeTankerkoenigEntry(registry, entry)
+		if err != nil {
+			slog.Error("cannot encode record", "err", err)
+			continue
+		}
+		if r.Float64() < malformed {
+			value = sim.Malformed(entry)
+			invalid++
+		}
+
+		msg := &kafka.Message{
+			TopicPartition: kafka.TopicPartition{
+				Topic:     &topic,
+				Partition: partition(entry.PostCode),
+			},
+			Key:   []byte(entry.Station.String()),
+			Value: value,
+		}
+		if err := p.Produce(msg, nil); err != nil {
+			slog.Error("record cannot be produced", "err", err)
+			continue
+		}
+		produced++
+		slog.Debug("record produced", "partition", msg.TopicPartition.Partition,
+			"value", string(value))
+	}
+
+	if remaining := p.Flush(10000); remaining > 0 {
+		slog.Warn("records not delivered on exit", "remaining", remaining)
+	}
+	slog.Info("simulation finished", "produced", produced, "malformed", invalid,
+		"delivered", delivered.Load(), "failed", failed.Load())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/google/uuid"
+)
+
+// PriceDynamics configures how the fuel prices of the simulated stations
+// evolve.
+type PriceDynamics struct {
+	// Base prices in € per litre.
+	Diesel float64
+	E5     float64
+	E10    float64
+	// Standard deviation of the fixed price offset of each station.
+	Spread float64
+	// Standard deviation of the random price change per update.
+	Volatility float64
+	// Amplitude of the daily price cycle. Prices peak in the morning and are
+	// lowest in the evening.
+	Daily float64
+}
+
+// A Station is a simulated fuel station.
+type Station struct {
+	ID       uuid.UUID
+	PostCode string
+
+	offset float64
+	drift  float64
+}
+
+// A Simulator simulates price updates of a fixed set of stations.
+type Simulator struct {
+	dynamics PriceDynamics
+	stations []*Station
+	r        *rand.Rand
+}
+
+// NewSimulator creates a simulator for n stations with random post codes.
+func NewSimulator(n int, dynamics PriceDynamics, r *rand.Rand) *Simulator {
+	stations := make([]*Station, n)
+	for i := range stations {
+		id, _ := uuid.NewRandomFromReader(r)
+		stations[i] = &Station{
+			ID: id,
+			// German post codes range from 01067 to 99998.
+			PostCode: fmt.Sprintf("%05d", 1067+r.Intn(99998-1067+1)),
+			offset:   r.NormFloat64() * dynamics.Spread,
+		}
+	}
+	return &Simulator{dynamics, stations, r}
+}
+
+// dailyCycle returns the price change of the daily cycle at time t. It is
+// highest at 7 a.m. and lowest at 7 p.m.
+func (s *Simulator) dailyCycle(t time.Time) float64 {
+	hour := float64(t.Hour()) + float64(t.Minute())/60
+	return s.dynamics.Daily * math.Cos(2*math.Pi*(hour-7)/24)
+}
+
+// price rounds a price in the way fuel stations display them, e.g. 1.789.
+func price(p float64) float64 {
+	return (math.Floor(p*100)*10 + 9) / 1000
+}
+
+// Next simulates a price update of a random station at time t.
+func (s *Simulator) Next(t time.Time) data.TankerkoenigEntry {
+	station := s.stations[s.r.Intn(len(s.stations))]
+	station.drift += s.r.NormFloat64() * s.dynamics.Volatility
+	// Pull the drift slowly back, so prices don't walk away.
+	station.drift *= 0.99
+
+	delta := station.offset + station.drift + s.dailyCycle(t)
+	return data.TankerkoenigEntry{
+		Date:     t,
+		Station:  station.ID,
+		PostCode: station.PostCode,
+		PDiesel:  price(s.dynamics.Diesel + delta),
+		PE5:      price(s.dynamics.E5 + delta),
+		PE10:     price(s.dynamics.E10 + delta),
+	}
+}
+
+// Malformed returns a malformed variant of the encoded entry e, which can't
+// be parsed by data.TankerkoenigEntry.UnmarshalJSON.
+func (s *Simulator) Malformed(e data.TankerkoenigEntry) []byte {
+	switch s.r.Intn(4) {
+	case 0:
+		// Truncated JSON
+		value, _ := e.MarshalJSON()
+		return value[:len(value)/2]
+	case 1:
+		return []byte(fmt.Sprintf(`{"date":%q,"station":%q,"postCode":%q,"pDiesel":%v,"pE5":%v,"pE10":%v}`,
+			e.Date.Format(time.RFC1123), e.Station, e.PostCode, e.PDiesel, e.PE5, e.PE10))
+	case 2:
+		return []byte(fmt.Sprintf(`{"date":%q,"station":"not-a-uuid","postCode":%q,"pDiesel":%v,"pE5":%v,"pE10":%v}`,
+			e.Date.Format(data.TimestampFormat), e.PostCode, e.PDiesel, e.PE5, e.PE10))
+	default:
+		return []byte(fmt.Sprintf(`{"date":%q,"station":%q,"postCode":%q,"pDiesel":"n/a","pE5":%v,"pE10":%v}`,
+			e.Date.Format(data.TimestampFormat), e.Station, e.PostCode, e.PE5, e.PE10))
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/kafkaclient"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/wrapper"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// Kafka configuration
+	KafkaBroker = "10.50.15.52"
+	KafkaTopic  = "weather"
+
+	// MQTT configuration
+	MQTTHost      = "10.50.12.150"
+	MQTTPort      = 1883
+	MQTTRootTopic = "/weather/"
+)
+
+var (
+	cities   []string
+	targets  map[string]bool
+	interval time.Duration
+	speed    float64
+	noise    float64
+	seed     int64
+	registry schema.Registry
+	format   data.Format
+
+	kafkaBroker string
+	kafkaTopic  string
+	kafkaConfig *kafkaclient.Config
+	mqttBroker  string
+	mqttQoS     int
+	mqttRetain  bool
+)
+
+// A Publisher publishes weather data records to a messaging system.
+type Publisher interface {
+	Publish(w data.WeatherData, payload []byte) error
+	Close()
+}
+
+type kafkaPublisher struct {
+	p *kafka.Producer
+}
+
+func newKafkaPublisher() (*kafkaPublisher, error) {
+	p, err := kafkaConfig.NewProducer(kafkaBroker, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create producer: %w", err)
+	}
+
+	// Log failed deliveries, which are reported on the events channel.
+	go func() {
+		for e := range p.Events() {
+			switch ev := e.(type) {
+			case *kafka.Message:
+				if ev.TopicPartition.Error != nil {
+					wrapper.MessageLogger(slog.Default(), ev).Error(
+						"message not delivered", "err", ev.TopicPartition.Error)
+				}
+			case kafka.Error:
+				slog.Warn("producer error", "broker", kafkaBroker, "err", ev)
+			}
+		}
+	}()
+	return &kafkaPublisher{p}, nil
+}
+
+func (k *kafkaPublisher) Publish(w data.WeatherData, payload []byte) error {
+	// Use the city as key, so that all records of a city are ordered.
+	return k.p.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &kafkaTopic, Partition: kafka.PartitionAny},
+		Key:            []byte(w.City),
+		Value:          payload,
+		Headers:        []kafka.Header{wrapper.ContentTypeHeader(format)},
+	}, nil)
+}
+
+func (k *kafkaPublisher) Close() {
+	if remaining := k.p.Flush(5000); remaining > 0 {
+		slog.Warn("messages not delivered on exit", "remaining", remaining)
+	}
+	k.p.Close()
+}
+
+type mqttPublisher struct {
+	c mqtt.Client
+}
+
+func newMQTTPublisher() (*mqttPublisher, error) {
+	opts := mqtt.NewClientOptions().AddBroker(mqttBroker)
+	c := mqtt.NewClient(opts)
+	if token := c.Connect(); token.Wait() && token.Error() != nil {
+		return nil, fmt.Errorf("cannot connect to broker '%v': %w", mqttBroker, token.Error())
+	}
+	return &mqttPublisher{c}, nil
+}
+
+func (m *mqttPublisher) Publish(w data.WeatherData, payload []byte) error {
+	topic := MQTTRootTopic + data.Location(w.City)
+	token := m.c.Publish(topic, byte(mqttQoS), mqttRetain, payload)
+	token.Wait()
+	return token.Error()
+}
+
+func (m *mqttPublisher) Close() {
+	m.c.Disconnect(250)
+}
+
+// init initializes all neccessary global variables, e.g. from the command line
+// interface.
+func init() {
+	var cityList, targetList string
+	flag.StringVar(&cityList, "cities", "Mosbach,Stuttgart,Bad Mergentheim",
+		"Comma separated list of cities to simulate.")
+	flag.StringVar(&targetList, "to", "kafka,mqtt",
+		"Comma separated list of targets to publish to, 'kafka' and/or 'mqtt'.")
+	flag.DurationVar(&interval, "i", 10*time.Second, "Interval between two records of a city.")
+	flag.Float64Var(&speed, "speed", 1,
+		"Speed of the simulated time, e.g. 60 simulates a minute each second.")
+	flag.Float64Var(&noise, "noise", 0.3, "Standard deviation of the temperature noise in °C.")
+	flag.Int64Var(&seed, "seed", time.Now().UnixNano(), "Seed of the random generator.")
+	flag.StringVar(&kafkaBroker, "kafka-broker", KafkaBroker, "Kafka bootstrap servers.")
+	flag.StringVar(&kafkaTopic, "kafka-topic", KafkaTopic, "Kafka topic to publish to.")
+	flag.StringVar(&mqttBroker, "mqtt-broker", fmt.Sprintf("tcp://%v:%v", MQTTHost, MQTTPort),
+		"MQTT broker URL.")
+	flag.IntVar(&mqttQoS, "mqtt-qos", 0, "MQTT QoS level, 0, 1 or 2.")
+	flag.BoolVar(&mqttRetain, "mqtt-retain", false, "Publish retained MQTT messages.")
+	var formatName string
+	flag.StringVar(&formatName, "format", string(data.FormatJSON),
+		"Payload format, 'json', 'protobuf' or 'avro'.")
+	registryLocation := schema.RegisterFlag()
+	kafkaConfig = kafkaclient.RegisterFlags()
+	logConfig := logging.RegisterFlags("info")
+	flag.Parse()
+	logConfig.Setup("weather_simulator")
+
+	for _, city := range strings.Split(cityList, ",") {
+		if city = strings.TrimSpace(city); city != "" {
+			cities = append(cities, city)
+		}
+	}
+	var errs []string
+	targets = map[string]bool{}
+	for _, target := range strings.Split(targetList, ",") {
+		switch target = strings.TrimSpace(target); target {
+		case "kafka", "mqtt":
+			targets[target] = true
+		case "":
+		default:
+			errs = append(errs, fmt.Sprintf("unknown target '%v', must be 'kafka' or 'mqtt'.", target))
+		}
+	}
+	if len(cities) == 0 {
+		errs = append(errs, "you must specify at least one city.")
+	}
+	if !targets["kafka"] && !targets["mqtt"] {
+		errs = append(errs, "you must specify at least one of the targets 'kafka' or 'mqtt'.")
+	}
+	if interval <= 0 || speed <= 0 {
+		errs = append(errs, "interval and speed must be positive.")
+	}
+	if mqttQoS < 0 || mqttQoS > 2 {
+		errs = append(errs, "the MQTT QoS level must be 0, 1 or 2.")
+	}
+	var err error
+	if format, err = data.ParseFormat(formatName); err != nil {
+		errs = append(errs, fmt.Sprintf("%v.", err))
+	}
+	if registry, err = schema.Open(*registryLocation); err != nil {
+		errs = append(errs, fmt.Sprintf("cannot open schema registry: %v", err))
+	}
+	if err = kafkaConfig.Load(); err != nil {
+		errs = append(errs, fmt.Sprintf("%v.", err))
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		}
+		flag.Usage()
+		os.Exit(1)
+	}
+}
+
+func main() {
+	var publishers []Publisher
+	if targets["kafka"] {
+		k, err := newKafkaPublisher()
+		if err != nil {
+			logging.Fatal("cannot create kafka publisher", "err", err)
+		}
+		publishers = append(publishers, k)
+	}
+	if targets["mqtt"] {
+		m, err := newMQTTPublisher()
+		if err != nil {
+			logging.Fatal("cannot create mqtt publisher", "err", err)
+		}
+		publishers = append(publishers, m)
+	}
+	defer func() {
+		for _, p := range publishers {
+			p.Close()
+		}
+	}()
+
+	r := rand.New(rand.NewSource(seed))
+	simulators := make([]*CitySimulator, len(cities))
+	for i, city := range cities {
+		simulators[i] = NewCitySimulator(city, noise, r)
+	}
+
+	// The simulated time starts now and runs speed times faster.
+	start := time.Now()
+	simTime := func() time.Time {
+		return start.Add(time.Duration(float64(time.Since(start)) * speed))
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	slog.Info("simulating weather data", "cities", cities, "interval", interval,
+		"speed", speed)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		now := simTime()
+		for _, s := range simulators {
+			w := s.Next(now)
+			payload, err := format.EncodeWeatherData(registry, w)
+			if err != nil {
+				slog.Error("cannot encode weather data", "city", w.City, "err", err)
+				continue
+			}
+			for _, p := range publishers {
+				if err := p.Publish(w, payload); err != nil {
+					slog.Error("cannot publish weather data", "city", w.City, "err", err)
+				}
+			}
+			slog.Debug("weather data published", "city", w.City,
+				"payload", string(payload))
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
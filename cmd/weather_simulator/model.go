@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+)
+
+// A CitySimulator simulates the weather of a single city. The current
+// temperature follows a diurnal curve with its minimum in the early morning
+// and its maximum in the afternoon, overlaid with smooth random noise. The
+// humidity follows the temperature inversely, the pressure and the wind
+// drift randomly.
+type CitySimulator struct {
+	City   string
+	CityID int
+
+	mean      float64
+	amplitude float64
+	noiseStd  float64
+
+	r       *rand.Rand
+	noise   float64
+	day     time.Time
+	tempMin float64
+	tempMax float64
+	publID  int
+
+	pressure      float64
+	windSpeed     float64
+	windDirection float64
+}
+
+// NewCitySimulator creates a simulator for city. The mean daily temperature
+// and the daily amplitude are chosen randomly from r, noise is the standard
+// deviation of the random noise in °C.
+func NewCitySimulator(city string, noise float64, r *rand.Rand) *CitySimulator {
+	// Derive a stable city ID from the name of the city.
+	h := fnv.New32a()
+	h.Write([]byte(city))
+
+	return &CitySimulator{
+		City:      city,
+		CityID:    int(h.Sum32() % 10000000),
+		mean:      8 + r.Float64()*8,
+		amplitude: 3 + r.Float64()*5,
+		noiseStd:  noise,
+		r:         r,
+		publID:    r.Intn(10000),
+
+		pressure:      1013 + r.NormFloat64()*5,
+		windSpeed:     2 + r.Float64()*3,
+		windDirection: r.Float64() * 360,
+	}
+}
+
+// diurnal returns the temperature of the diurnal curve at time t without
+// noise. The minimum is reached at 3 a.m. and the maximum at 3 p.m.
+func (s *CitySimulator) diurnal(t time.Time) float64 {
+	hour := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+	return s.mean + s.amplitude*math.Sin(2*math.Pi*(hour-9)/24)
+}
+
+// Next simulates the weather at time t. Consecutive calls must use
+// increasing times. The minimum and maximum temperatures are tracked per day
+// and reset at midnight.
+func (s *CitySimulator) Next(t time.Time) data.WeatherData {
+	// Use an AR(1) process, so the noise changes smoothly between records.
+	s.noise = 0.8*s.noise + s.r.NormFloat64()*s.noiseStd
+	current := s.diurnal(t) + s.noise
+
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if !day.Equal(s.day) {
+		s.day = day
+		s.tempMin = current
+		s.tempMax = current
+	}
+	s.tempMin = math.Min(s.tempMin, current)
+	s.tempMax = math.Max(s.tempMax, current)
+	s.publID++
+
+	// The relative humidity is high in the cold morning and low in the warm
+	// afternoon.
+	humidity := round(math.Max(0, math.Min(100, 75-4*(current-s.mean)+s.r.NormFloat64()*2)))
+	// Let pressure and wind drift around their typical values.
+	s.pressure += 0.05*(1013-s.pressure) + s.r.NormFloat64()*0.3
+	s.windSpeed = math.Max(0, s.windSpeed+0.1*(3-s.windSpeed)+s.r.NormFloat64()*0.5)
+	s.windDirection = math.Mod(s.windDirection+s.r.NormFloat64()*10+360, 360)
+	pressure := round(s.pressure)
+	windSpeed := round(s.windSpeed)
+	windDirection := math.Round(s.windDirection)
+
+	return data.WeatherData{
+		TempCurrent:   round(current),
+		TempMax:       round(s.tempMax),
+		TempMin:       round(s.tempMin),
+		Comment:       fmt.Sprintf("Publ.Id %v", s.publID),
+		TimeStamp:     t,
+		City:          s.City,
+		CityID:        s.CityID,
+		Humidity:      &humidity,
+		Pressure:      &pressure,
+		WindSpeed:     &windSpeed,
+		WindDirection: &windDirection,
+	}
+}
+
+// round rounds f to two decimal places.
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -1,6 +1,6 @@
 module github.com/dateiexplorer/dhbw-vslab-applications
 
-go 1.17
+go 1.22.0
 
 require github.com/confluentinc/confluent-kafka-go v1.8.2
 
@@ -8,8 +8,16 @@ require github.com/google/uuid v1.3.0
 
 require (
 	github.com/eclipse/paho.mqtt.golang v1.3.5
+	github.com/hamba/avro/v2 v2.27.0
 	github.com/jtaczanowski/go-graphite-client v1.1.0
 	golang.org/x/net v0.0.0-20220531201128-c960675eff93
+	google.golang.org/protobuf v1.34.2
 )
 
-require github.com/gorilla/websocket v1.4.2 // indirect
+require (
+	github.com/gorilla/websocket v1.4.2 // indirect
+	github.com/json-iterator/go v1.1.12 // indirect
+	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+)
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
+)
+
+// ContentTypeHeader is the name of the Kafka header that contains the
+// content type of the message value.
+const ContentTypeHeader = "content-type"
+
+// A Format is an encoding of the payloads.
+type Format string
+
+const (
+	// FormatJSON is the JSON encoding described by the schemas in the schema
+	// package. It is the default, if no format is specified.
+	FormatJSON Format = "json"
+	// FormatProtobuf is the Protobuf encoding described by weather.proto.
+	FormatProtobuf Format = "protobuf"
+	// FormatAvro is the Avro binary encoding described by weather.avsc.
+	FormatAvro Format = "avro"
+)
+
+// Formats contains all supported formats.
+var Formats = []Format{FormatJSON, FormatProtobuf, FormatAvro}
+
+var contentTypes = map[Format]string{
+	FormatJSON:     "application/json",
+	FormatProtobuf: "application/x-protobuf",
+	FormatAvro:     "avro/binary",
+}
+
+// ParseFormat returns the format with the name s.
+func ParseFormat(s string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown payload format '%v'", s)
+}
+
+// FormatOfContentType returns the format of the content type ct. Parameters
+// of the content type, e.g. '; charset=utf-8', are ignored. An empty content
+// type is considered to be JSON, which was the only format before content
+// types were introduced.
+func FormatOfContentType(ct string) (Format, error) {
+	ct = strings.TrimSpace(strings.SplitN(ct, ";", 2)[0])
+	if ct == "" {
+		return FormatJSON, nil
+	}
+	for f, t := range contentTypes {
+		if strings.EqualFold(t, ct) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported content type '%v'", ct)
+}
+
+// ContentType returns the content type of the format.
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// EncodeWeatherData encodes w in the format f. The registry r is only used
+// for JSON, see EncodeWeatherData.
+func (f Format) EncodeWeatherData(r schema.Registry, w WeatherData) ([]byte, error) {
+	switch f {
+	case FormatJSON, "":
+		return EncodeWeatherData(r, w)
+	case FormatProtobuf:
+		return marshalWeatherDataProtobuf(w), nil
+	case FormatAvro:
+		return marshalWeatherDataAvro(w)
+	}
+	return nil, fmt.Errorf("unknown payload format '%v'", f)
+}
+
+// DecodeWeatherData decodes the payload b in the format f. The registry r
+// is only used for JSON, see DecodeWeatherData.
+func (f Format) DecodeWeatherData(r schema.Registry, b []byte) (*WeatherData, error) {
+	switch f {
+	case FormatJSON, "":
+		return DecodeWeatherData(r, b)
+	case FormatProtobuf:
+		return unmarshalWeatherDataProtobuf(b)
+	case FormatAvro:
+		return unmarshalWeatherDataAvro(b)
+	}
+	return nil, fmt.Errorf("unknown payload format '%v'", f)
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A TankerkoenigEntry represents an entry from the Kafka tankerkoenig topic.
+type TankerkoenigEntry struct {
+	Date     time.Time
+	Station  uuid.UUID
+	PostCode string
+	PDiesel  float64
+	PE5      float64
+	PE10     float64
+}
+
+// tankerkoenigEntryJSON is the wire format of a TankerkoenigEntry.
+type tankerkoenigEntryJSON struct {
+	Date     string  `json:"date"`
+	Station  string  `json:"station"`
+	PostCode string  `json:"postCode"`
+	PDiesel  float64 `json:"pDiesel"`
+	PE5      float64 `json:"pE5"`
+	PE10     float64 `json:"pE10"`
+}
+
+func (t *TankerkoenigEntry) UnmarshalJSON(data []byte) error {
+	var tmp tankerkoenigEntryJSON
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+
+	station, err := uuid.Parse(tmp.Station)
+	if err != nil {
+		return fmt.Errorf("invalid station '%v': %w", tmp.Station, err)
+	}
+	t.Station = station
+	t.PostCode = tmp.PostCode
+	t.PDiesel = tmp.PDiesel
+	t.PE5 = tmp.PE5
+	t.PE10 = tmp.PE10
+
+	date, err := time.Parse(TimestampFormat, tmp.Date)
+	if err != nil {
+		return err
+	}
+	t.Date = date
+	return nil
+}
+
+func (t TankerkoenigEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tankerkoenigEntryJSON{
+		Date:     t.Date.Format(TimestampFormat),
+		Station:  t.Station.String(),
+		PostCode: t.PostCode,
+		PDiesel:  t.PDiesel,
+		PE5:      t.PE5,
+		PE10:     t.PE10,
+	})
+}
+
+func (t TankerkoenigEntry) String() string {
+	return fmt.Sprintf("{ date: %v, station: %v, postCode: %v, pDiesel: %v, pE5: %v, pE10: %v }",
+		t.Date, t.Station.String(), t.PostCode, t.PDiesel, t.PE5, t.PE10)
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// A Unit is a temperature unit. Temperatures of WeatherData are always
+// stored in Celsius and converted on output.
+type Unit string
+
+const (
+	Celsius    Unit = "C"
+	Fahrenheit Unit = "F"
+	Kelvin     Unit = "K"
+)
+
+// ParseUnit parses a temperature unit, e.g. 'C', '°F', 'kelvin'. An empty
+// string is Celsius, which is the unit of the weather topics.
+func ParseUnit(s string) (Unit, error) {
+	switch strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "°")) {
+	case "", "c", "celsius":
+		return Celsius, nil
+	case "f", "fahrenheit":
+		return Fahrenheit, nil
+	case "k", "kelvin":
+		return Kelvin, nil
+	}
+	return "", fmt.Errorf("unknown temperature unit '%v'", s)
+}
+
+// Symbol returns the symbol of the unit, e.g. '°C'.
+func (u Unit) Symbol() string {
+	if u == Kelvin {
+		return "K"
+	}
+	return "°" + string(u)
+}
+
+// FromCelsius converts the temperature c in Celsius to the unit.
+func (u Unit) FromCelsius(c float64) float64 {
+	switch u {
+	case Fahrenheit:
+		return c*9/5 + 32
+	case Kelvin:
+		return c + 273.15
+	}
+	return c
+}
+
+// ToCelsius converts the temperature t in the unit to Celsius.
+func (u Unit) ToCelsius(t float64) float64 {
+	switch u {
+	case Fahrenheit:
+		return (t - 32) * 5 / 9
+	case Kelvin:
+		return t - 273.15
+	}
+	return t
+}
+
+// FeelsLike returns the perceived temperature in Celsius. Below 10 °C it is
+// the wind chill, if the wind speed is known and above 4.8 km/h. Above 27 °C
+// it is the heat index, if the humidity is known. Otherwise it is the
+// current temperature.
+func (d WeatherData) FeelsLike() float64 {
+	t := d.TempCurrent
+	if d.WindSpeed != nil && t <= 10 {
+		// Wind chill formula of the North American and UK weather services,
+		// which uses the wind speed in km/h.
+		v := *d.WindSpeed * 3.6
+		if v > 4.8 {
+			p := math.Pow(v, 0.16)
+			return 13.12 + 0.6215*t - 11.37*p + 0.3965*t*p
+		}
+	}
+	if d.Humidity != nil && t >= 27 {
+		// Heat index regression of Rothfusz, which uses Fahrenheit.
+		f := Fahrenheit.FromCelsius(t)
+		rh := *d.Humidity
+		hi := -42.379 + 2.04901523*f + 10.14333127*rh - 0.22475541*f*rh -
+			6.83783e-3*f*f - 5.481717e-2*rh*rh + 1.22874e-3*f*f*rh +
+			8.5282e-4*f*rh*rh - 1.99e-6*f*f*rh*rh
+		return Fahrenheit.ToCelsius(hi)
+	}
+	return t
+}
+
+// DewPoint returns the dew point in Celsius, calculated with the Magnus
+// formula. ok is false if the humidity is unknown.
+func (d WeatherData) DewPoint() (dewPoint float64, ok bool) {
+	if d.Humidity == nil || *d.Humidity <= 0 {
+		return 0, false
+	}
+	const b, c = 17.62, 243.12
+	gamma := math.Log(*d.Humidity/100) + b*d.TempCurrent/(c+d.TempCurrent)
+	return c * gamma / (b - gamma), true
+}
@@ -0,0 +1,156 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
+)
+
+// Decoders for each schema version of the payloads. If a new version of a
+// schema is added in the schema package, add a decoder for it here, which
+// reads the properties of that version only. A new version must be readable
+// by the decoders of the previous versions, see schema.Schema.CheckBackward.
+var (
+	weatherDataDecoders = map[int]func([]byte, *WeatherData) error{
+		1: decodeWeatherDataV1,
+		2: decodeWeatherDataV2,
+		3: func(b []byte, w *WeatherData) error { return json.Unmarshal(b, w) },
+	}
+	tankerkoenigEntryDecoders = map[int]func([]byte, *TankerkoenigEntry) error{
+		1: func(b []byte, t *TankerkoenigEntry) error { return json.Unmarshal(b, t) },
+	}
+)
+
+// weatherDataJSONV1 holds the properties of the versions 1 and 2 of the
+// weather schema.
+type weatherDataJSONV1 struct {
+	TempCurrent float64         `json:"tempCurrent"`
+	TempMax     float64         `json:"tempMax"`
+	TempMin     float64         `json:"tempMin"`
+	Comment     string          `json:"comment"`
+	TimeStamp   json.RawMessage `json:"timeStamp"`
+	City        string          `json:"city"`
+	CityID      int             `json:"cityId"`
+}
+
+func (v weatherDataJSONV1) weatherData(t time.Time) WeatherData {
+	return WeatherData{
+		TempCurrent: v.TempCurrent,
+		TempMax:     v.TempMax,
+		TempMin:     v.TempMin,
+		Comment:     v.Comment,
+		TimeStamp:   t,
+		City:        v.City,
+		CityID:      v.CityID,
+	}
+}
+
+// decodeWeatherDataV1 decodes version 1 of the weather schema, in which the
+// timestamp is a string in TimestampFormat.
+func decodeWeatherDataV1(b []byte, w *WeatherData) error {
+	var v weatherDataJSONV1
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var timeStamp string
+	if err := json.Unmarshal(v.TimeStamp, &timeStamp); err != nil {
+		return fmt.Errorf("invalid timestamp %v: %w", string(v.TimeStamp), err)
+	}
+	t, err := time.Parse(TimestampFormat, timeStamp)
+	if err != nil {
+		return fmt.Errorf("cannot parse timestamp '%v'", timeStamp)
+	}
+	*w = v.weatherData(t)
+	return nil
+}
+
+// decodeWeatherDataV2 decodes version 2 of the weather schema, which accepts
+// all timestamps of ParseTimestamp. Temperatures are always in Celsius and
+// the properties added in version 3 are ignored.
+func decodeWeatherDataV2(b []byte, w *WeatherData) error {
+	var v weatherDataJSONV1
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	t, err := parseTimestampJSON(v.TimeStamp)
+	if err != nil {
+		return err
+	}
+	*w = v.weatherData(t)
+	return nil
+}
+
+// DecodeWeatherData decodes a weather data payload. The schema version of
+// framed payloads is resolved with the registry r, which may be nil if only
+// unframed payloads are expected. The payload is validated against its
+// schema before decoding.
+func DecodeWeatherData(r schema.Registry, b []byte) (*WeatherData, error) {
+	s, payload, err := schema.Resolve(r, schema.WeatherSubject, b)
+	if err != nil {
+		return nil, err
+	}
+	decode, ok := weatherDataDecoders[s.Version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported version %v of schema '%v'", s.Version, s.Subject)
+	}
+
+	var w WeatherData
+	if err := decode(payload, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// EncodeWeatherData encodes w in the latest schema version. If the registry
+// r isn't nil, the schema is registered and the payload is framed with the
+// schema ID, otherwise the unframed payload is returned.
+func EncodeWeatherData(r schema.Registry, w WeatherData) ([]byte, error) {
+	payload, err := json.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+	return frame(r, schema.WeatherSubject, payload)
+}
+
+// DecodeTankerkoenigEntry decodes a tankerkoenig payload like
+// DecodeWeatherData.
+func DecodeTankerkoenigEntry(r schema.Registry, b []byte) (*TankerkoenigEntry, error) {
+	s, payload, err := schema.Resolve(r, schema.TankerkoenigSubject, b)
+	if err != nil {
+		return nil, err
+	}
+	decode, ok := tankerkoenigEntryDecoders[s.Version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported version %v of schema '%v'", s.Version, s.Subject)
+	}
+
+	var t TankerkoenigEntry
+	if err := decode(payload, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// EncodeTankerkoenigEntry encodes t like EncodeWeatherData.
+func EncodeTankerkoenigEntry(r schema.Registry, t TankerkoenigEntry) ([]byte, error) {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return frame(r, schema.TankerkoenigSubject, payload)
+}
+
+// frame frames the payload with the ID of the latest schema of subject, if
+// the registry r isn't nil.
+func frame(r schema.Registry, subject string, payload []byte) ([]byte, error) {
+	if r == nil {
+		return payload, nil
+	}
+	s, err := schema.RegisterLatest(r, subject)
+	if err != nil {
+		return nil, fmt.Errorf("cannot register schema '%v': %w", subject, err)
+	}
+	return schema.Frame(s.ID, payload), nil
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
+)
+
+func TestDecodeWeatherDataVersions(t *testing.T) {
+	r, err := schema.OpenFile(filepath.Join(t.TempDir(), "schemas.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[int]int{}
+	for version := 1; version <= schema.LatestVersion(schema.WeatherSubject); version++ {
+		definition, err := schema.Definition(schema.WeatherSubject, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := r.Register(schema.WeatherSubject, definition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[version] = s.ID
+	}
+
+	ts := time.Date(2022, 5, 6, 12, 10, 10, 124e6, time.FixedZone("", 2*60*60))
+	v1 := `{"tempCurrent":20,"city":"Mosbach","cityId":1,"timeStamp":"2022-05-06T12:10:10.124+02:00"}`
+	epoch := `{"tempCurrent":20,"city":"Mosbach","cityId":1,"timeStamp":1651831810124}`
+	fahrenheit := `{"tempCurrent":68,"tempUnit":"F","humidity":50,"city":"Mosbach","cityId":1,"timeStamp":1651831810124}`
+
+	tests := []struct {
+		name     string
+		version  int
+		payload  string
+		temp     float64
+		humidity bool
+		err      bool
+	}{
+		{"v1", 1, v1, 20, false, false},
+		{"v1 with epoch timestamp", 1, epoch, 0, false, true},
+		{"v1 with RFC 3339 timestamp", 1, `{"city":"Mosbach","timeStamp":"2022-05-06T10:10:10.124Z"}`, 0, false, true},
+		{"v2", 2, v1, 20, false, false},
+		{"v2 with epoch timestamp", 2, epoch, 20, false, false},
+		{"v2 ignores v3 properties", 2, fahrenheit, 68, false, false},
+		{"v3", 3, fahrenheit, 20, true, false},
+		{"unframed", 0, fahrenheit, 20, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := []byte(tt.payload)
+			if tt.version > 0 {
+				b = schema.Frame(ids[tt.version], b)
+			}
+			w, err := DecodeWeatherData(r, b)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if w.City != "Mosbach" || w.CityID != 1 || !w.TimeStamp.Equal(ts) {
+				t.Errorf("got %+v", w)
+			}
+			if w.TempCurrent != tt.temp {
+				t.Errorf("tempCurrent = %v, want %v", w.TempCurrent, tt.temp)
+			}
+			if (w.Humidity != nil) != tt.humidity {
+				t.Errorf("humidity = %v, want set %v", w.Humidity, tt.humidity)
+			}
+		})
+	}
+}
@@ -3,12 +3,17 @@ package data
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const TimestampFormat = "2006-01-02T15:04:05.000-07:00"
 
+// A WeatherData represents a weather record of a city. Temperatures are in
+// Celsius. The optional fields are nil if they aren't part of the payload.
 type WeatherData struct {
 	TempCurrent float64
 	TempMax     float64
@@ -17,45 +22,192 @@ type WeatherData struct {
 	TimeStamp   time.Time
 	City        string
 	CityID      int
+
+	// Humidity is the relative humidity in percent.
+	Humidity *float64
+	// Pressure is the air pressure in hPa.
+	Pressure *float64
+	// WindSpeed is the wind speed in m/s.
+	WindSpeed *float64
+	// WindDirection is the direction the wind comes from in degrees.
+	WindDirection *float64
+}
+
+// Location returns the location of a city as used in MQTT topics and
+// Graphite metrics, e.g. 'bad-mergentheim' for 'Bad Mergentheim'.
+func Location(city string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(city), " ", "-"))
 }
 
 // String returns a pretty printed weather data record to print on the command
 // line.
 func (d WeatherData) String() string {
+	return d.Format(Celsius)
+}
+
+// Format returns a pretty printed weather data record like String with
+// temperatures in the unit u.
+func (d WeatherData) Format(u Unit) string {
+	temp := func(c float64) string {
+		return strconv.FormatFloat(math.Round(u.FromCelsius(c)*100)/100, 'f', -1, 64)
+	}
+
 	var b strings.Builder
 	b.WriteString(fmt.Sprintf("Weather data for '%v' at %v:\n", d.City, d.TimeStamp))
 	b.WriteString(fmt.Sprintf("  Comment: %v\n", d.Comment))
-	b.WriteString(fmt.Sprintf("  Current Temp (in °C): %v\n", d.TempCurrent))
-	b.WriteString(fmt.Sprintf("  Min Temp (in °C): %v\n", d.TempMin))
-	b.WriteString(fmt.Sprintf("  Max Temp (in °C): %v\n", d.TempMax))
+	b.WriteString(fmt.Sprintf("  Current Temp (in %v): %v\n", u.Symbol(), temp(d.TempCurrent)))
+	b.WriteString(fmt.Sprintf("  Min Temp (in %v): %v\n", u.Symbol(), temp(d.TempMin)))
+	b.WriteString(fmt.Sprintf("  Max Temp (in %v): %v\n", u.Symbol(), temp(d.TempMax)))
+	b.WriteString(fmt.Sprintf("  Feels like (in %v): %v\n", u.Symbol(), temp(d.FeelsLike())))
+	if dewPoint, ok := d.DewPoint(); ok {
+		b.WriteString(fmt.Sprintf("  Dew point (in %v): %v\n", u.Symbol(), temp(dewPoint)))
+	}
+	if d.Humidity != nil {
+		b.WriteString(fmt.Sprintf("  Humidity (in %%): %v\n", *d.Humidity))
+	}
+	if d.Pressure != nil {
+		b.WriteString(fmt.Sprintf("  Pressure (in hPa): %v\n", *d.Pressure))
+	}
+	if d.WindSpeed != nil {
+		b.WriteString(fmt.Sprintf("  Wind speed (in m/s): %v\n", *d.WindSpeed))
+	}
+	if d.WindDirection != nil {
+		b.WriteString(fmt.Sprintf("  Wind direction (in °): %v\n", *d.WindDirection))
+	}
 	return b.String()
 }
 
-func (d *WeatherData) UnmarshalJSON(data []byte) error {
-	var tmp struct {
-		TempCurrent float64 `json:"tempCurrent"`
-		TempMax     float64 `json:"tempMax"`
-		TempMin     float64 `json:"tempMin"`
-		Comment     string  `json:"comment"`
-		TimeStamp   string  `json:"timeStamp"`
-		City        string  `json:"city"`
-		CityID      int     `json:"cityId"`
+// timestampLayouts are the layouts accepted for timestamps, in addition to
+// Unix epoch seconds and milliseconds. Fractional seconds are optional in all
+// layouts. Timestamps without zone are considered to be local time.
+var timestampLayouts = []string{
+	TimestampFormat,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// epochMillisThreshold separates epoch seconds from epoch milliseconds. As
+// seconds it is in the year 5138, as milliseconds in 1973, so all realistic
+// timestamps are classified correctly.
+const epochMillisThreshold = 1e11
+
+// epochPattern matches the accepted Unix epoch timestamps: decimal digits
+// with an optional fraction, but no sign, exponent or special values like
+// 'NaN' that strconv.ParseFloat accepts as well.
+var epochPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// ParseTimestamp parses a timestamp in one of the supported layouts, e.g.
+// '2022-05-06T12:10:10.124+02:00', '2022-05-06T10:10:10Z' or
+// '2022-05-06T12:10:10', or as Unix epoch seconds or milliseconds, e.g.
+// '1651831810' or '1651831810124'.
+func ParseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if epochPattern.MatchString(s) {
+		epoch, err := strconv.ParseFloat(s, 64)
+		// Larger epochs don't fit into an int64 of milliseconds.
+		if err != nil || epoch >= math.MaxInt64 {
+			return time.Time{}, fmt.Errorf("timestamp '%v' out of range", s)
+		}
+		return fromEpoch(epoch), nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse timestamp '%v'", s)
+}
+
+// parseTimestampJSON parses a JSON timestamp, which is either a string or a
+// number, both are handled by ParseTimestamp.
+func parseTimestampJSON(raw json.RawMessage) (time.Time, error) {
+	var timeStamp string
+	if err := json.Unmarshal(raw, &timeStamp); err != nil {
+		timeStamp = string(raw)
 	}
+	return ParseTimestamp(timeStamp)
+}
+
+// fromEpoch converts Unix epoch seconds or milliseconds to a time. Fractions
+// of seconds are rounded to microseconds, as a float64 isn't more precise
+// for current epoch seconds.
+func fromEpoch(epoch float64) time.Time {
+	if epoch >= epochMillisThreshold {
+		return time.UnixMilli(int64(epoch))
+	}
+	sec, frac := math.Modf(epoch)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e6))*1e3)
+}
+
+// weatherDataJSON is the wire format of WeatherData. The timestamp is either
+// a string or a number of epoch seconds or milliseconds, see ParseTimestamp.
+// The temperatures are in the unit TempUnit, Celsius if it is empty.
+type weatherDataJSON struct {
+	TempCurrent   float64         `json:"tempCurrent"`
+	TempMax       float64         `json:"tempMax"`
+	TempMin       float64         `json:"tempMin"`
+	TempUnit      string          `json:"tempUnit,omitempty"`
+	Comment       string          `json:"comment"`
+	TimeStamp     json.RawMessage `json:"timeStamp"`
+	City          string          `json:"city"`
+	CityID        int             `json:"cityId"`
+	Humidity      *float64        `json:"humidity,omitempty"`
+	Pressure      *float64        `json:"pressure,omitempty"`
+	WindSpeed     *float64        `json:"windSpeed,omitempty"`
+	WindDirection *float64        `json:"windDirection,omitempty"`
+}
 
+// MarshalJSON encodes the weather data in the wire format of the weather
+// topic. The timestamp is written in TimestampFormat, so it is read back
+// unchanged up to milliseconds.
+func (d WeatherData) MarshalJSON() ([]byte, error) {
+	timeStamp, err := json.Marshal(d.TimeStamp.Format(TimestampFormat))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(weatherDataJSON{
+		TempCurrent:   d.TempCurrent,
+		TempMax:       d.TempMax,
+		TempMin:       d.TempMin,
+		Comment:       d.Comment,
+		TimeStamp:     timeStamp,
+		City:          d.City,
+		CityID:        d.CityID,
+		Humidity:      d.Humidity,
+		Pressure:      d.Pressure,
+		WindSpeed:     d.WindSpeed,
+		WindDirection: d.WindDirection,
+	})
+}
+
+func (d *WeatherData) UnmarshalJSON(data []byte) error {
+	var tmp weatherDataJSON
 	if err := json.Unmarshal(data, &tmp); err != nil {
 		return err
 	}
-	d.TempCurrent = tmp.TempCurrent
-	d.TempMax = tmp.TempMax
-	d.TempMin = tmp.TempMin
-	d.Comment = tmp.Comment
-	d.City = tmp.City
-	d.CityID = tmp.CityID
 
-	timeStamp, err := time.Parse(TimestampFormat, tmp.TimeStamp)
+	t, err := parseTimestampJSON(tmp.TimeStamp)
+	if err != nil {
+		return err
+	}
+	unit, err := ParseUnit(tmp.TempUnit)
 	if err != nil {
 		return err
 	}
-	d.TimeStamp = timeStamp
+
+	d.TempCurrent = unit.ToCelsius(tmp.TempCurrent)
+	d.TempMax = unit.ToCelsius(tmp.TempMax)
+	d.TempMin = unit.ToCelsius(tmp.TempMin)
+	d.Comment = tmp.Comment
+	d.TimeStamp = t
+	d.City = tmp.City
+	d.CityID = tmp.CityID
+	d.Humidity = tmp.Humidity
+	d.Pressure = tmp.Pressure
+	d.WindSpeed = tmp.WindSpeed
+	d.WindDirection = tmp.WindDirection
 	return nil
 }
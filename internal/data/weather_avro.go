@@ -0,0 +1,136 @@
+package data
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+// WeatherDataAvroSchema is the Avro schema of the weather data, see
+// FormatAvro. New fields must be appended with a default value, so payloads
+// written with an older version can still be decoded.
+//
+//go:embed weather.avsc
+var WeatherDataAvroSchema string
+
+// weatherDataAvroSchemaV1 is the schema before the optional fields were
+// added.
+//
+//go:embed weather.v1.avsc
+var weatherDataAvroSchemaV1 string
+
+var weatherDataAvroSchema = avro.MustParse(WeatherDataAvroSchema)
+
+// weatherDataAvroWriters are the older schemas, newest first, resolved
+// against the current schema. Avro payloads don't carry the schema they were
+// written with, so a payload is decoded with the first schema that reads it
+// exactly. This is unambiguous as long as fields are only appended: an older
+// payload is too short for a newer schema and a newer one too long for an
+// older schema.
+var weatherDataAvroWriters = resolveAvroWriters(weatherDataAvroSchema, weatherDataAvroSchemaV1)
+
+// resolveAvroWriters parses the writer schemas and resolves them against the
+// reader schema. It panics if a schema is invalid or incompatible.
+func resolveAvroWriters(reader avro.Schema, writers ...string) []avro.Schema {
+	compatibility := avro.NewSchemaCompatibility()
+	resolved := make([]avro.Schema, len(writers))
+	for i, w := range writers {
+		// Use an own cache, as all versions share the name of the record.
+		writer, err := avro.ParseWithCache(w, "", &avro.SchemaCache{})
+		if err != nil {
+			panic(fmt.Sprintf("invalid avro writer schema: %v", err))
+		}
+		if resolved[i], err = compatibility.Resolve(reader, writer); err != nil {
+			panic(fmt.Sprintf("incompatible avro writer schema: %v", err))
+		}
+	}
+	return resolved
+}
+
+// weatherDataAvro is the Avro record of WeatherData.
+type weatherDataAvro struct {
+	TempCurrent float64   `avro:"tempCurrent"`
+	TempMax     float64   `avro:"tempMax"`
+	TempMin     float64   `avro:"tempMin"`
+	Comment     string    `avro:"comment"`
+	TimeStamp   time.Time `avro:"timeStamp"`
+	City        string    `avro:"city"`
+	CityID      int64     `avro:"cityId"`
+
+	Humidity      *float64 `avro:"humidity"`
+	Pressure      *float64 `avro:"pressure"`
+	WindSpeed     *float64 `avro:"windSpeed"`
+	WindDirection *float64 `avro:"windDirection"`
+}
+
+// marshalWeatherDataAvro encodes w as WeatherData record.
+func marshalWeatherDataAvro(w WeatherData) ([]byte, error) {
+	return avro.Marshal(weatherDataAvroSchema, weatherDataAvro{
+		TempCurrent: w.TempCurrent,
+		TempMax:     w.TempMax,
+		TempMin:     w.TempMin,
+		Comment:     w.Comment,
+		TimeStamp:   w.TimeStamp,
+		City:        w.City,
+		CityID:      int64(w.CityID),
+
+		Humidity:      w.Humidity,
+		Pressure:      w.Pressure,
+		WindSpeed:     w.WindSpeed,
+		WindDirection: w.WindDirection,
+	})
+}
+
+// unmarshalWeatherDataAvro decodes a WeatherData record.
+func unmarshalWeatherDataAvro(b []byte) (*WeatherData, error) {
+	var tmp weatherDataAvro
+	err := unmarshalAvroExactly(weatherDataAvroSchema, b, &tmp)
+	for _, writer := range weatherDataAvroWriters {
+		if err == nil {
+			break
+		}
+		tmp = weatherDataAvro{}
+		if unmarshalAvroExactly(writer, b, &tmp) == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro payload: %w", err)
+	}
+	return &WeatherData{
+		TempCurrent: tmp.TempCurrent,
+		TempMax:     tmp.TempMax,
+		TempMin:     tmp.TempMin,
+		Comment:     tmp.Comment,
+		TimeStamp:   tmp.TimeStamp.Local(),
+		City:        tmp.City,
+		CityID:      int(tmp.CityID),
+
+		Humidity:      tmp.Humidity,
+		Pressure:      tmp.Pressure,
+		WindSpeed:     tmp.WindSpeed,
+		WindDirection: tmp.WindDirection,
+	}, nil
+}
+
+// unmarshalAvroExactly decodes b with schema into v. Unlike avro.Unmarshal, it
+// fails if b is too short or too long for schema.
+func unmarshalAvroExactly(schema avro.Schema, b []byte, v any) error {
+	r := avro.NewReader(nil, 0).Reset(b)
+	r.ReadVal(schema, v)
+	if errors.Is(r.Error, io.EOF) {
+		return io.ErrUnexpectedEOF
+	} else if r.Error != nil {
+		return r.Error
+	}
+	// Peek sets io.EOF if all bytes were read.
+	r.Peek()
+	if !errors.Is(r.Error, io.EOF) {
+		return errors.New("unexpected trailing bytes")
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+// weatherDataAvroV1 is the Avro record of the first schema version.
+type weatherDataAvroV1 struct {
+	TempCurrent float64   `avro:"tempCurrent"`
+	TempMax     float64   `avro:"tempMax"`
+	TempMin     float64   `avro:"tempMin"`
+	Comment     string    `avro:"comment"`
+	TimeStamp   time.Time `avro:"timeStamp"`
+	City        string    `avro:"city"`
+	CityID      int64     `avro:"cityId"`
+}
+
+func TestUnmarshalWeatherDataAvroVersions(t *testing.T) {
+	ts := time.UnixMilli(1654336800000)
+	humidity := 65.0
+
+	v1Schema, err := avro.ParseWithCache(weatherDataAvroSchemaV1, "", &avro.SchemaCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1, err := avro.Marshal(v1Schema, weatherDataAvroV1{
+		TempCurrent: 12.5, TempMax: 14, TempMin: 9, TimeStamp: ts, City: "Mosbach", CityID: 2869120,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := marshalWeatherDataAvro(WeatherData{
+		TempCurrent: 12.5, TempMax: 14, TempMin: 9, TimeStamp: ts, City: "Mosbach", CityID: 2869120,
+		Humidity: &humidity,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		payload  []byte
+		humidity *float64
+	}{
+		{"v1", v1, nil},
+		{"v2", v2, &humidity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := unmarshalWeatherDataAvro(tt.payload)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w.City != "Mosbach" || w.CityID != 2869120 || w.TempCurrent != 12.5 || !w.TimeStamp.Equal(ts) {
+				t.Errorf("got %+v", w)
+			}
+			if (w.Humidity == nil) != (tt.humidity == nil) || (w.Humidity != nil && *w.Humidity != *tt.humidity) {
+				t.Errorf("humidity = %v, want %v", w.Humidity, tt.humidity)
+			}
+			if w.Pressure != nil || w.WindSpeed != nil || w.WindDirection != nil {
+				t.Errorf("unset optional fields decoded as %+v", w)
+			}
+		})
+	}
+}
+
+func TestUnmarshalWeatherDataAvroInvalid(t *testing.T) {
+	valid, err := marshalWeatherDataAvro(WeatherData{City: "Mosbach"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trailing := append(valid, 0x00, 0x00)
+	for _, payload := range [][]byte{nil, {0x01, 0x02}, trailing} {
+		if _, err := unmarshalWeatherDataAvro(payload); err == nil {
+			t.Errorf("payload %v: expected an error", payload)
+		}
+	}
+}
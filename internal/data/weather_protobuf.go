@@ -0,0 +1,148 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the WeatherData message in weather.proto.
+const (
+	weatherProtoTempCurrent   protowire.Number = 1
+	weatherProtoTempMax       protowire.Number = 2
+	weatherProtoTempMin       protowire.Number = 3
+	weatherProtoComment       protowire.Number = 4
+	weatherProtoTimeStamp     protowire.Number = 5
+	weatherProtoCity          protowire.Number = 6
+	weatherProtoCityID        protowire.Number = 7
+	weatherProtoHumidity      protowire.Number = 8
+	weatherProtoPressure      protowire.Number = 9
+	weatherProtoWindSpeed     protowire.Number = 10
+	weatherProtoWindDirection protowire.Number = 11
+)
+
+func appendProtoDouble(b []byte, n protowire.Number, v float64) []byte {
+	// Fields with default values are omitted in proto3.
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, n, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+// appendProtoOptionalDouble appends an optional field, which is written if
+// it is set, even if it has the default value.
+func appendProtoOptionalDouble(b []byte, n protowire.Number, v *float64) []byte {
+	if v == nil {
+		return b
+	}
+	b = protowire.AppendTag(b, n, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(*v))
+}
+
+func appendProtoString(b []byte, n protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, n, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendProtoInt64(b []byte, n protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, n, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// marshalWeatherDataProtobuf encodes w as WeatherData message.
+func marshalWeatherDataProtobuf(w WeatherData) []byte {
+	var b []byte
+	b = appendProtoDouble(b, weatherProtoTempCurrent, w.TempCurrent)
+	b = appendProtoDouble(b, weatherProtoTempMax, w.TempMax)
+	b = appendProtoDouble(b, weatherProtoTempMin, w.TempMin)
+	b = appendProtoString(b, weatherProtoComment, w.Comment)
+	// The timestamp is required, so it is written even at the Unix epoch,
+	// where it has the default value.
+	if !w.TimeStamp.IsZero() {
+		b = protowire.AppendTag(b, weatherProtoTimeStamp, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(w.TimeStamp.UnixMilli()))
+	}
+	b = appendProtoString(b, weatherProtoCity, w.City)
+	b = appendProtoInt64(b, weatherProtoCityID, int64(w.CityID))
+	b = appendProtoOptionalDouble(b, weatherProtoHumidity, w.Humidity)
+	b = appendProtoOptionalDouble(b, weatherProtoPressure, w.Pressure)
+	b = appendProtoOptionalDouble(b, weatherProtoWindSpeed, w.WindSpeed)
+	b = appendProtoOptionalDouble(b, weatherProtoWindDirection, w.WindDirection)
+	return b
+}
+
+// unmarshalWeatherDataProtobuf decodes a WeatherData message. Unknown fields
+// are skipped, so fields can be added to the message. The timestamp is
+// required.
+func unmarshalWeatherDataProtobuf(b []byte) (*WeatherData, error) {
+	var w WeatherData
+	var hasTimeStamp bool
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, fmt.Errorf("invalid protobuf payload: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		switch {
+		case num == weatherProtoTempCurrent && typ == protowire.Fixed64Type:
+			w.TempCurrent, n = consumeProtoDouble(b)
+		case num == weatherProtoTempMax && typ == protowire.Fixed64Type:
+			w.TempMax, n = consumeProtoDouble(b)
+		case num == weatherProtoTempMin && typ == protowire.Fixed64Type:
+			w.TempMin, n = consumeProtoDouble(b)
+		case num == weatherProtoComment && typ == protowire.BytesType:
+			w.Comment, n = protowire.ConsumeString(b)
+		case num == weatherProtoTimeStamp && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			w.TimeStamp = time.UnixMilli(int64(v))
+			hasTimeStamp = true
+		case num == weatherProtoCity && typ == protowire.BytesType:
+			w.City, n = protowire.ConsumeString(b)
+		case num == weatherProtoCityID && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			w.CityID = int(int64(v))
+		case num == weatherProtoHumidity && typ == protowire.Fixed64Type:
+			w.Humidity, n = consumeProtoOptionalDouble(b)
+		case num == weatherProtoPressure && typ == protowire.Fixed64Type:
+			w.Pressure, n = consumeProtoOptionalDouble(b)
+		case num == weatherProtoWindSpeed && typ == protowire.Fixed64Type:
+			w.WindSpeed, n = consumeProtoOptionalDouble(b)
+		case num == weatherProtoWindDirection && typ == protowire.Fixed64Type:
+			w.WindDirection, n = consumeProtoOptionalDouble(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("invalid protobuf payload in field %v: %w",
+				num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	if !hasTimeStamp {
+		return nil, fmt.Errorf("invalid protobuf payload: missing field %v (time_stamp)",
+			weatherProtoTimeStamp)
+	}
+	return &w, nil
+}
+
+func consumeProtoDouble(b []byte) (float64, int) {
+	v, n := protowire.ConsumeFixed64(b)
+	return math.Float64frombits(v), n
+}
+
+func consumeProtoOptionalDouble(b []byte) (*float64, int) {
+	v, n := consumeProtoDouble(b)
+	return &v, n
+}
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestWeatherDataProtobufRoundTrip(t *testing.T) {
+	humidity := 0.0
+	tests := []struct {
+		name string
+		w    WeatherData
+	}{
+		{"all fields", WeatherData{
+			TempCurrent: 12.5, TempMax: 14, TempMin: -9, Comment: "cloudy",
+			TimeStamp: time.UnixMilli(1654336800124), City: "Mosbach", CityID: 2869120,
+			Humidity: &humidity,
+		}},
+		{"Unix epoch", WeatherData{TimeStamp: time.UnixMilli(0), City: "Mosbach"}},
+		{"before Unix epoch", WeatherData{TimeStamp: time.UnixMilli(-1000)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := unmarshalWeatherDataProtobuf(marshalWeatherDataProtobuf(tt.w))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !w.TimeStamp.Equal(tt.w.TimeStamp) {
+				t.Errorf("timestamp = %v, want %v", w.TimeStamp, tt.w.TimeStamp)
+			}
+			if w.String() != tt.w.String() {
+				t.Errorf("got %+v, want %+v", w, tt.w)
+			}
+			if (w.Humidity == nil) != (tt.w.Humidity == nil) {
+				t.Errorf("humidity = %v, want %v", w.Humidity, tt.w.Humidity)
+			}
+			if w.Pressure != nil || w.WindSpeed != nil || w.WindDirection != nil {
+				t.Errorf("unset optional fields decoded as %+v", w)
+			}
+		})
+	}
+}
+
+func TestUnmarshalWeatherDataProtobufUnknownField(t *testing.T) {
+	ts := time.UnixMilli(1654336800000)
+	b := marshalWeatherDataProtobuf(WeatherData{TimeStamp: ts, City: "Mosbach"})
+	b = protowire.AppendTag(b, 42, protowire.BytesType)
+	b = protowire.AppendString(b, "unknown")
+	b = protowire.AppendTag(b, 43, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1)
+
+	w, err := unmarshalWeatherDataProtobuf(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.City != "Mosbach" || !w.TimeStamp.Equal(ts) {
+		t.Errorf("got %+v", w)
+	}
+}
+
+func TestUnmarshalWeatherDataProtobufInvalid(t *testing.T) {
+	valid := marshalWeatherDataProtobuf(WeatherData{
+		TimeStamp: time.UnixMilli(1654336800000), City: "Mosbach",
+	})
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"empty", nil},
+		{"missing timestamp", marshalWeatherDataProtobuf(WeatherData{City: "Mosbach"})},
+		{"truncated", valid[:len(valid)-1]},
+		{"truncated tag", append(valid, 0x80)},
+		{"wrong wire type", protowire.AppendTag(valid, weatherProtoCity, protowire.Fixed64Type)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w, err := unmarshalWeatherDataProtobuf(tt.payload); err == nil {
+				t.Errorf("expected an error, got %+v", w)
+			}
+		})
+	}
+}
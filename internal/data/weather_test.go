@@ -0,0 +1,177 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	utc := time.Date(2022, 5, 6, 10, 10, 10, 0, time.UTC)
+	millis := utc.Add(124 * time.Millisecond)
+
+	tests := []struct {
+		s    string
+		want time.Time
+	}{
+		// Unix epoch seconds and milliseconds.
+		{"1651831810", utc},
+		{"1651831810.124", millis},
+		{"1651831810124", millis},
+		{" 1651831810 ", utc},
+		{"0", time.Unix(0, 0)},
+		{"99999999999", time.Unix(99999999999, 0)},
+		{"100000000000", time.UnixMilli(100000000000)},
+
+		// RFC 3339 variants.
+		{"2022-05-06T12:10:10.124+02:00", millis},
+		{"2022-05-06T12:10:10+02:00", utc},
+		{"2022-05-06T10:10:10Z", utc},
+		{"2022-05-06T10:10:10.124Z", millis},
+		{"2022-05-06T10:10:10.124000001Z", millis.Add(time.Nanosecond)},
+		{"2022-05-06T12:10:10.124+0200", millis},
+		{"2022-05-06 12:10:10.124+02:00", millis},
+
+		// Without zone in local time.
+		{"2022-05-06T10:10:10", time.Date(2022, 5, 6, 10, 10, 10, 0, time.Local)},
+		{"2022-05-06 10:10:10.124", time.Date(2022, 5, 6, 10, 10, 10, 124e6, time.Local)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseTimestamp(tt.s)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimestampInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"now",
+		"2022-05-06",
+		"2022-13-06T10:10:10Z",
+		"2022-05-06T25:10:10Z",
+		"06.05.2022 10:10:10",
+		"2022-05-06T10:10:10+02",
+		"1651831810s",
+		"NaN",
+		"Inf",
+		"-Inf",
+		"1e300",
+		"1.65e9",
+		"0x1p3",
+		"-1651831810",
+		"+1651831810",
+		"1651831810.",
+		".5",
+		"9223372036854775808",
+		strings.Repeat("9", 400),
+	} {
+		t.Run(s, func(t *testing.T) {
+			if got, err := ParseTimestamp(s); err == nil {
+				t.Errorf("expected an error, got %v", got)
+			}
+		})
+	}
+}
+
+func TestWeatherDataJSON(t *testing.T) {
+	humidity := 50.0
+	w := WeatherData{
+		TempCurrent: 20.5,
+		TempMax:     22,
+		TempMin:     18,
+		Comment:     "sunny",
+		TimeStamp:   time.Date(2022, 5, 6, 12, 10, 10, 124987654, time.FixedZone("", 2*60*60)),
+		City:        "Mosbach",
+		CityID:      2869120,
+		Humidity:    &humidity,
+	}
+
+	b, err := json.Marshal(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"timeStamp":"2022-05-06T12:10:10.124+02:00"`) {
+		t.Errorf("timestamp not in TimestampFormat: %s", b)
+	}
+	for _, name := range []string{"tempUnit", "pressure", "windSpeed", "windDirection"} {
+		if strings.Contains(string(b), name) {
+			t.Errorf("unset property '%v' encoded: %s", name, b)
+		}
+	}
+
+	var got WeatherData
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.TimeStamp.Equal(w.TimeStamp.Truncate(time.Millisecond)) {
+		t.Errorf("timestamp = %v, want %v", got.TimeStamp, w.TimeStamp.Truncate(time.Millisecond))
+	}
+	got.TimeStamp = w.TimeStamp
+	if got.String() != w.String() || *got.Humidity != humidity {
+		t.Errorf("got %+v, want %+v", got, w)
+	}
+}
+
+func TestWeatherDataUnmarshalJSON(t *testing.T) {
+	utc := time.Date(2022, 5, 6, 10, 10, 10, 0, time.UTC)
+	tests := []struct {
+		name    string
+		payload string
+		temp    float64
+		err     bool
+	}{
+		{"string timestamp", `{"tempCurrent":20,"timeStamp":"2022-05-06T10:10:10Z"}`, 20, false},
+		{"epoch seconds", `{"tempCurrent":20,"timeStamp":1651831810}`, 20, false},
+		{"epoch milliseconds", `{"tempCurrent":20,"timeStamp":1651831810000}`, 20, false},
+		{"epoch as string", `{"tempCurrent":20,"timeStamp":"1651831810"}`, 20, false},
+		{"fahrenheit", `{"tempCurrent":68,"tempUnit":"F","timeStamp":1651831810}`, 20, false},
+		{"missing timestamp", `{"tempCurrent":20}`, 0, true},
+		{"invalid timestamp", `{"tempCurrent":20,"timeStamp":"yesterday"}`, 0, true},
+		{"NaN timestamp", `{"tempCurrent":20,"timeStamp":"NaN"}`, 0, true},
+		{"exponent timestamp", `{"tempCurrent":20,"timeStamp":1.651831810e9}`, 0, true},
+		{"negative timestamp", `{"tempCurrent":20,"timeStamp":-1}`, 0, true},
+		{"boolean timestamp", `{"tempCurrent":20,"timeStamp":true}`, 0, true},
+		{"invalid unit", `{"tempCurrent":20,"tempUnit":"X","timeStamp":1651831810}`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w WeatherData
+			err := json.Unmarshal([]byte(tt.payload), &w)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !w.TimeStamp.Equal(utc) || w.TempCurrent != tt.temp {
+				t.Errorf("got %v and %v, want %v and %v", w.TimeStamp, w.TempCurrent, utc, tt.temp)
+			}
+		})
+	}
+}
+
+func TestLocation(t *testing.T) {
+	tests := []struct {
+		city string
+		want string
+	}{
+		{"Mosbach", "mosbach"},
+		{"Bad Mergentheim", "bad-mergentheim"},
+		{" Bad Mergentheim ", "bad-mergentheim"},
+		{"Schwäbisch Hall", "schwäbisch-hall"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Location(tt.city); got != tt.want {
+			t.Errorf("Location(%q) = %q, want %q", tt.city, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,656 @@
+// Package expr implements simple boolean expressions over named values, e.g.
+// 'tempCurrent > 30 || tempMin < 0', used to filter records on the command
+// line.
+//
+// The syntax is similar to Go, with the operators in the order of their
+// precedence, from lowest to highest:
+//
+//	||                             logical or
+//	&&                             logical and
+//	==  !=  <  <=  >  >=           comparisons of numbers and strings
+//	=~  !~                         regular expression match of strings
+//	+  -                           addition and subtraction
+//	*  /                           multiplication and division
+//	!  -                           unary not and negation
+//
+// Operands are grouped with parentheses and are one of:
+//
+//	42  1.5  'text'  "text"        number and string literals
+//	true  false  null              constants
+//	name                           named value, see Vars
+//
+// Comparisons and matches bind equally and can't be chained. As in Go,
+// '!a == b' is '(!a) == b'.
+//
+// Missing values are null. Comparisons and matches with null are false,
+// except 'name == null' and 'name != null', so optional values can be
+// tested.
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Type is the type of a named value or an expression.
+type Type int
+
+const (
+	// Any is the type of values which are only known at evaluation.
+	Any Type = iota
+	Bool
+	Number
+	String
+	// null is the type of the constant null.
+	null
+)
+
+func (t Type) String() string {
+	switch t {
+	case Bool:
+		return "boolean"
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case null:
+		return "null"
+	}
+	return "any"
+}
+
+// Vars resolves the values of names. Values are float64, string, bool or
+// nil, matching the types passed to Compile. ok is false if the value is
+// missing.
+type Vars func(name string) (v any, ok bool)
+
+// An Expr is a compiled expression.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile compiles the expression src and checks that it evaluates to a
+// boolean. If names isn't nil, only the given names may be used in the
+// expression and the types of their values are checked. Otherwise any name
+// may be used and its type is only known at evaluation.
+func Compile(src string, names map[string]Type) (*Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, names: names}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression '%v': %w", src, err)
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("invalid expression '%v': unexpected '%v'", src, t.text)
+	}
+	if t := root.typ(); t != Bool && t != Any {
+		return nil, fmt.Errorf("invalid expression '%v': the result must be a boolean, not a %v", src, t)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Match evaluates the expression with the values of vars and reports
+// whether the result is true.
+func (e *Expr) Match(vars Vars) (bool, error) {
+	v, err := e.root.eval(vars)
+	if err != nil {
+		return false, fmt.Errorf("cannot evaluate '%v': %w", e.src, err)
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("cannot evaluate '%v': result %v isn't a boolean", e.src, v)
+	}
+	return b, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+}
+
+// operators sorted so that longer operators are matched first.
+var operators = []string{"||", "&&", "==", "!=", "<=", ">=", "=~", "!~",
+	"<", ">", "!", "+", "-", "*", "/", "(", ")"}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+		case isDigit(c) || c == '.':
+			j := i
+			for j < len(src) && (isDigit(rune(src[j])) || src[j] == '.' ||
+				src[j] == 'e' || src[j] == 'E' ||
+				((src[j] == '-' || src[j] == '+') && j > i && (src[j-1] == 'e' || src[j-1] == 'E'))) {
+				j++
+			}
+			n, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number '%v'", src[i:j])
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[i:j], num: n})
+			i = j
+		case c == '\'' || c == '"':
+			j := strings.IndexByte(src[i+1:], src[i])
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string at position %v", i)
+			}
+			text := src[i+1 : i+1+j]
+			tokens = append(tokens, token{kind: tokenString, text: text})
+			i += j + 2
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) {
+				r, size := utf8.DecodeRuneInString(src[j:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+					break
+				}
+				j += size
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[i:j]})
+			i = j
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokenOp, text: op})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character '%c' at position %v", c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, text: "end of expression"}), nil
+}
+
+// isDigit reports whether c is an ASCII digit, which are the only digits of
+// number literals.
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	names  map[string]Type
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators ops.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOperands("||", Bool, left, right); err != nil {
+			return nil, err
+		}
+		left = &logical{op: "||", left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOperands("&&", Bool, left, right); err != nil {
+			return nil, err
+		}
+		left = &logical{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "=~", "!~")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if op == "=~" || op == "!~" {
+		if err := checkOperands(op, String, left); err != nil {
+			return nil, err
+		}
+		lit, ok := right.(literal)
+		s, isString := lit.v.(string)
+		if !ok || !isString {
+			return nil, fmt.Errorf("the right side of '%v' must be a string", op)
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, err
+		}
+		return &match{negate: op == "!~", left: left, re: re}, nil
+	}
+	lt, rt := left.typ(), right.typ()
+	if lt != Any && lt != null && rt != Any && rt != null && lt != rt {
+		return nil, fmt.Errorf("cannot compare %v with %v", lt, rt)
+	}
+	if (lt == Bool || rt == Bool) && op != "==" && op != "!=" {
+		return nil, fmt.Errorf("cannot compare booleans with '%v'", op)
+	}
+	return &comparison{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOperands(op, Number, left, right); err != nil {
+			return nil, err
+		}
+		left = &arithmetic{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseProduct() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOperands(op, Number, left, right); err != nil {
+			return nil, err
+		}
+		left = &arithmetic{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	op, ok := p.accept("!", "-")
+	if !ok {
+		return p.parsePrimary()
+	}
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if op == "!" {
+		if err := checkOperands(op, Bool, operand); err != nil {
+			return nil, err
+		}
+		return &not{operand}, nil
+	}
+	if err := checkOperands(op, Number, operand); err != nil {
+		return nil, err
+	}
+	return &arithmetic{op: "-", left: literal{0.0}, right: operand}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return literal{t.num}, nil
+	case tokenString:
+		return literal{t.text}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		}
+		if p.names == nil {
+			return variable{t.text, Any}, nil
+		}
+		typ, ok := p.names[t.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown name '%v'", t.text)
+		}
+		return variable{t.text, typ}, nil
+	case tokenOp:
+		if t.text == "(" {
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, fmt.Errorf("missing ')'")
+			}
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected '%v'", t.text)
+}
+
+// checkOperands checks that the operands of op are of the type want. Values
+// of type Any are only checked at evaluation, null is always accepted.
+func checkOperands(op string, want Type, operands ...node) error {
+	for _, n := range operands {
+		if t := n.typ(); t != want && t != Any && t != null {
+			return fmt.Errorf("invalid operand of '%v': %v isn't a %v", op, t, want)
+		}
+	}
+	return nil
+}
+
+// A node is a node of the syntax tree.
+type node interface {
+	eval(vars Vars) (any, error)
+	// typ returns the type of the result of eval.
+	typ() Type
+}
+
+type literal struct {
+	v any
+}
+
+func (l literal) eval(Vars) (any, error) {
+	return l.v, nil
+}
+
+func (l literal) typ() Type {
+	switch l.v.(type) {
+	case bool:
+		return Bool
+	case float64:
+		return Number
+	case string:
+		return String
+	}
+	return null
+}
+
+type variable struct {
+	name string
+	t    Type
+}
+
+func (v variable) eval(vars Vars) (any, error) {
+	value, ok := vars(v.name)
+	if !ok {
+		return nil, nil
+	}
+	return value, nil
+}
+
+func (v variable) typ() Type {
+	return v.t
+}
+
+type logical struct {
+	op          string
+	left, right node
+}
+
+func (l *logical) eval(vars Vars) (any, error) {
+	left, err := evalBool(l.left, vars)
+	if err != nil {
+		return nil, err
+	}
+	// Evaluate the right side only if necessary.
+	if (l.op == "||" && left) || (l.op == "&&" && !left) {
+		return left, nil
+	}
+	return evalBool(l.right, vars)
+}
+
+func (*logical) typ() Type {
+	return Bool
+}
+
+type not struct {
+	operand node
+}
+
+func (n *not) eval(vars Vars) (any, error) {
+	v, err := evalBool(n.operand, vars)
+	return !v, err
+}
+
+func (*not) typ() Type {
+	return Bool
+}
+
+func evalBool(n node, vars Vars) (bool, error) {
+	v, err := n.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("%v isn't a boolean", v)
+}
+
+type comparison struct {
+	op          string
+	left, right node
+}
+
+func (c *comparison) eval(vars Vars) (any, error) {
+	left, err := c.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	if left == nil || right == nil {
+		switch c.op {
+		case "==":
+			return left == right, nil
+		case "!=":
+			return left != right, nil
+		}
+		return false, nil
+	}
+
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %v with %v", left, right)
+		}
+		cmp = compare(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare '%v' with %v", left, right)
+		}
+		cmp = strings.Compare(l, r)
+	case bool:
+		r, ok := right.(bool)
+		if !ok || (c.op != "==" && c.op != "!=") {
+			return nil, fmt.Errorf("cannot compare %v with %v", left, right)
+		}
+		if l == r {
+			cmp = 0
+		} else {
+			cmp = 1
+		}
+	default:
+		return nil, fmt.Errorf("cannot compare %v", left)
+	}
+
+	switch c.op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func (*comparison) typ() Type {
+	return Bool
+}
+
+func compare(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+type match struct {
+	negate bool
+	left   node
+	re     *regexp.Regexp
+}
+
+func (m *match) eval(vars Vars) (any, error) {
+	v, err := m.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return false, nil
+	}
+	return m.re.MatchString(s) != m.negate, nil
+}
+
+func (*match) typ() Type {
+	return Bool
+}
+
+type arithmetic struct {
+	op          string
+	left, right node
+}
+
+func (a *arithmetic) eval(vars Vars) (any, error) {
+	left, err := a.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := a.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot calculate %v %v %v", left, a.op, right)
+	}
+	switch a.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	}
+	return l / r, nil
+}
+
+func (*arithmetic) typ() Type {
+	return Number
+}
@@ -0,0 +1,161 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+)
+
+var testNames = map[string]Type{
+	"temp":     Number,
+	"humidity": Number,
+	"city":     String,
+	"raining":  Bool,
+	"größe":    Number,
+}
+
+func testVars(name string) (any, bool) {
+	switch name {
+	case "temp":
+		return 25.0, true
+	case "city":
+		return "Bad Mergentheim", true
+	case "raining":
+		return false, true
+	case "größe":
+		return 3.0, true
+	}
+	return nil, false
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// Comparisons and arithmetic.
+		{"temp > 20", true},
+		{"temp >= 25 && temp <= 25", true},
+		{"temp != 25", false},
+		{"temp - 5 == 20", true},
+		{"-temp < 0", true},
+		{"1e1 < temp", true},
+		{"city == 'Bad Mergentheim'", true},
+		{`city < "C"`, true},
+		{"raining == false", true},
+		{"größe == 3", true},
+
+		// Precedence.
+		{"1 + 2 * 3 == 7", true},
+		{"(1 + 2) * 3 == 9", true},
+		{"10 - 4 - 3 == 3", true},
+		{"12 / 2 / 3 == 2", true},
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"!raining == true", true},
+		{"!(temp > 20)", false},
+		{"!!raining", false},
+		{"temp > 20 && !raining", true},
+
+		// Regular expressions.
+		{"city =~ '^Bad'", true},
+		{"city !~ '^Bad'", false},
+
+		// Missing values.
+		{"humidity == null", true},
+		{"humidity != null", false},
+		{"humidity > 50", false},
+		{"humidity <= 50", false},
+		{"humidity + 1 == null", true},
+		{"!(humidity > 50)", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := Compile(tt.src, testNames)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := e.Match(testVars)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		// Syntax.
+		{"", "unexpected 'end of expression'"},
+		{"temp >", "unexpected 'end of expression'"},
+		{"(temp > 20", "missing ')'"},
+		{"temp > 20)", "unexpected ')'"},
+		{"temp > 20 > 10", "unexpected '>'"},
+		{"city == 'Mosbach", "unterminated string"},
+		{"temp > 1.2.3", "invalid number '1.2.3'"},
+		{"temp # 20", "unexpected character '#'"},
+		{"temp > 20 € 1", "unexpected character '€'"},
+		{"city =~ '['", "missing closing ]"},
+		{"city =~ temp", "the right side of '=~' must be a string"},
+		{"wind > 20", "unknown name 'wind'"},
+
+		// Types.
+		{"temp + 1", "the result must be a boolean, not a number"},
+		{"city", "the result must be a boolean, not a string"},
+		{"null", "the result must be a boolean, not a null"},
+		{"temp == 'hot'", "cannot compare number with string"},
+		{"raining < true", "cannot compare booleans with '<'"},
+		{"city + 1 > 0", "invalid operand of '+': string isn't a number"},
+		{"-city == 0", "invalid operand of '-': string isn't a number"},
+		{"temp && raining", "invalid operand of '&&': number isn't a boolean"},
+		{"!temp > 20", "invalid operand of '!': number isn't a boolean"},
+		{"temp =~ '1'", "invalid operand of '=~': number isn't a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Compile(tt.src, testNames)
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %q, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMatchUntyped(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+		err  bool
+	}{
+		{"temp > 20 && city =~ 'Mergentheim$'", true, false},
+		{"unknown == null", true, false},
+		{"unknown =~ '.*'", false, false},
+		{"raining", false, false},
+		{"temp", false, true},
+		{"temp == 'hot'", false, true},
+		{"city * 2 > 0", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := Compile(tt.src, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := e.Match(testVars)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Package graphitesink sends weather data as metrics to Graphite. It is the
+// sink shared by the bridges from Kafka and MQTT.
+package graphitesink
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/health"
+	"github.com/jtaczanowski/go-graphite-client"
+)
+
+// The Graphite server of the lab and the prefix of the weather metrics.
+const (
+	Host          = "10.50.15.52"
+	Port          = 2003
+	MetricsPrefix = "vlvs_inf19b.5703004.weather"
+	Protocol      = "tcp"
+)
+
+// A Sink sends weather data to Graphite and records the result of the last
+// send, which can be used as readiness check.
+type Sink struct {
+	host   string
+	client *graphite.Client
+	status health.Status
+}
+
+// New creates a sink for the Graphite server at host and port. All metrics
+// are prefixed with prefix.
+func New(host string, port int, prefix, protocol string) *Sink {
+	return &Sink{host: host, client: graphite.NewClient(host, port, prefix, protocol)}
+}
+
+// Metrics returns the metrics of a weather data record, named
+// '<city>.<value>' with the city as data.Location.
+func Metrics(w *data.WeatherData) map[string]float64 {
+	city := data.Location(w.City)
+	var metrics = map[string]float64{
+		fmt.Sprintf("%v.tempCurrent", city): w.TempCurrent,
+		fmt.Sprintf("%v.tempMin", city):     w.TempMin,
+		fmt.Sprintf("%v.tempMax", city):     w.TempMax,
+		fmt.Sprintf("%v.feelsLike", city):   w.FeelsLike(),
+	}
+	// Add the optional values only if they are part of the record, so no
+	// gaps are filled with zeros.
+	if dewPoint, ok := w.DewPoint(); ok {
+		metrics[fmt.Sprintf("%v.dewPoint", city)] = dewPoint
+	}
+	optional := map[string]*float64{
+		"humidity":      w.Humidity,
+		"pressure":      w.Pressure,
+		"windSpeed":     w.WindSpeed,
+		"windDirection": w.WindDirection,
+	}
+	for name, v := range optional {
+		if v != nil {
+			metrics[fmt.Sprintf("%v.%v", city, name)] = *v
+		}
+	}
+	return metrics
+}
+
+// Send sends the metrics of w with its timestamp to Graphite. Errors are
+// logged and reported by Check.
+func (s *Sink) Send(w *data.WeatherData) {
+	metrics := Metrics(w)
+	timestamp := w.TimeStamp.Unix()
+	logger := slog.With("city", data.Location(w.City), "graphiteHost", s.host)
+	err := s.client.SendDataWithTimeStamp(metrics, timestamp)
+	s.status.Set(err)
+	if err != nil {
+		logger.Error("error while sending data to graphite", "err", err)
+	} else {
+		logger.Info("send data to graphite", "metrics", metrics,
+			"timestamp", timestamp, "local", time.Unix(timestamp, 0).Local())
+	}
+}
+
+// Check returns the error of the last send, if any.
+func (s *Sink) Check() error {
+	return s.status.Check()
+}
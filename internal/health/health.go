@@ -0,0 +1,173 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Check reports the health of a single component. It returns nil if the
+// component is healthy and an error describing the problem otherwise.
+type Check func() error
+
+// A Monitor collects liveness and readiness checks of an application and
+// serves them over HTTP on the '/healthz' and '/readyz' endpoints.
+//
+// A failing liveness check means that the application should be restarted,
+// a failing readiness check means that the application is running but cannot
+// do its work yet, e.g. because no partitions are assigned.
+type Monitor struct {
+	mu        sync.RWMutex
+	liveness  map[string]Check
+	readiness map[string]Check
+}
+
+func NewMonitor() *Monitor {
+	return &Monitor{
+		liveness:  map[string]Check{},
+		readiness: map[string]Check{},
+	}
+}
+
+// AddLivenessCheck adds a check with the given name to the '/healthz'
+// endpoint. An existing check with the same name is replaced.
+func (m *Monitor) AddLivenessCheck(name string, check Check) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.liveness[name] = check
+}
+
+// AddReadinessCheck adds a check with the given name to the '/readyz'
+// endpoint. An existing check with the same name is replaced.
+func (m *Monitor) AddReadinessCheck(name string, check Check) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.readiness[name] = check
+}
+
+// report is the JSON response of the health endpoints.
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func (m *Monitor) serve(w http.ResponseWriter, checks map[string]Check) {
+	m.mu.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r := report{Status: "ok", Checks: make(map[string]string, len(names))}
+	for _, name := range names {
+		if err := checks[name](); err != nil {
+			r.Status = "failed"
+			r.Checks[name] = err.Error()
+		} else {
+			r.Checks[name] = "ok"
+		}
+	}
+	m.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(r)
+}
+
+// Register registers the '/healthz' and '/readyz' endpoints on mux.
+func (m *Monitor) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		m.serve(w, m.liveness)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		m.serve(w, m.readiness)
+	})
+}
+
+// ListenAndServe serves the health endpoints on addr in a separate goroutine.
+// If addr is empty, nothing happens.
+func (m *Monitor) ListenAndServe(addr string) {
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	m.Register(mux)
+	go func() {
+		slog.Info("serving health endpoints", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("health endpoints stopped", "addr", addr, "err", err)
+		}
+	}()
+}
+
+// A Heartbeat records the time of the last occurrence of an event, e.g. the
+// last received message.
+type Heartbeat struct {
+	mu      sync.RWMutex
+	started time.Time
+	last    time.Time
+}
+
+func NewHeartbeat() *Heartbeat {
+	return &Heartbeat{started: time.Now()}
+}
+
+// Beat records the occurrence of an event now.
+func (h *Heartbeat) Beat() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = time.Now()
+}
+
+// Since returns the time elapsed since the last event. If no event occurred
+// yet, it returns the time elapsed since the Heartbeat was created.
+func (h *Heartbeat) Since() time.Duration {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.last.IsZero() {
+		return time.Since(h.started)
+	}
+	return time.Since(h.last)
+}
+
+// Check returns a Check that fails if no event occurred within maxAge.
+// If maxAge is 0, the Check never fails.
+func (h *Heartbeat) Check(maxAge time.Duration) Check {
+	return func() error {
+		since := h.Since().Truncate(time.Second)
+		if maxAge > 0 && since > maxAge {
+			return fmt.Errorf("no event since %v (max %v)", since, maxAge)
+		}
+		return nil
+	}
+}
+
+// A Status holds the result of the last operation of a component, e.g. the
+// last write to a database.
+type Status struct {
+	mu  sync.RWMutex
+	err error
+}
+
+// Set records the result err of the last operation. A nil err marks the
+// component as healthy.
+func (s *Status) Set(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// Check returns the result of the last operation.
+func (s *Status) Check() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
@@ -0,0 +1,238 @@
+package kafkaclient
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// PasswordEnv is the environment variable the SASL password is read from, if
+// the '-kafka-password' flag isn't set. This keeps the password out of the
+// process list.
+const PasswordEnv = "KAFKA_PASSWORD"
+
+// Mechanisms contains the supported SASL mechanisms.
+var Mechanisms = []string{"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"}
+
+// Config holds the security configuration and additional librdkafka
+// properties of Kafka clients, usually set from the command line interface.
+// The zero value and nil connect without authentication and encryption.
+type Config struct {
+	// SecurityProtocol is 'plaintext', 'ssl', 'sasl_plaintext' or 'sasl_ssl'.
+	// If empty, it is derived from the SASL and SSL settings.
+	SecurityProtocol string
+	// Mechanism is the SASL mechanism, see Mechanisms. Defaults to 'PLAIN' if
+	// a username is set.
+	Mechanism string
+	Username  string
+	Password  string
+	// CAFile is a PEM file with the certificates to verify the brokers with.
+	CAFile string
+	// CertFile and KeyFile are PEM files with the client certificate and its
+	// private key, if the brokers authenticate clients by certificate.
+	CertFile string
+	KeyFile  string
+	// ConfigFile is a properties file with librdkafka properties, one
+	// 'key=value' pair per line.
+	ConfigFile string
+	// Properties are librdkafka properties of the form 'key=value'. They
+	// override the properties of the config file.
+	Properties []string
+
+	properties kafka.ConfigMap
+}
+
+// RegisterFlags registers the '-kafka-*' security flags on the default flag
+// set and returns the Config the values are written to. Call Load or Setup
+// after flag.Parse() to validate the configuration.
+func RegisterFlags() *Config {
+	return RegisterFlagSet(flag.CommandLine)
+}
+
+// RegisterFlagSet registers the '-kafka-*' security flags on fs, see
+// RegisterFlags.
+func RegisterFlagSet(fs *flag.FlagSet) *Config {
+	c := &Config{}
+	fs.StringVar(&c.SecurityProtocol, "kafka-security-protocol", "",
+		"Kafka security protocol, 'plaintext', 'ssl', 'sasl_plaintext' or 'sasl_ssl'. Derived from the other flags if empty.")
+	fs.StringVar(&c.Mechanism, "kafka-sasl-mechanism", "",
+		fmt.Sprintf("SASL mechanism, one of '%v'. Defaults to 'PLAIN' if a username is set.",
+			strings.Join(Mechanisms, "', '")))
+	fs.StringVar(&c.Username, "kafka-username", "", "SASL username to authenticate with at the brokers.")
+	fs.StringVar(&c.Password, "kafka-password", "",
+		fmt.Sprintf("SASL password to authenticate with at the brokers, defaults to $%v.", PasswordEnv))
+	fs.StringVar(&c.CAFile, "kafka-ca", "", "PEM file with the CA certificates to verify the brokers.")
+	fs.StringVar(&c.CertFile, "kafka-cert", "", "PEM file with the client certificate.")
+	fs.StringVar(&c.KeyFile, "kafka-key", "", "PEM file with the private key of the client certificate.")
+	fs.StringVar(&c.ConfigFile, "kafka-config", "",
+		"Properties file with additional librdkafka properties, one 'key=value' per line.")
+	fs.Func("kafka-property",
+		"Additional librdkafka property as 'key=value', e.g. 'client.id=weather'. Can be repeated.",
+		func(s string) error {
+			c.Properties = append(c.Properties, s)
+			return nil
+		})
+	return c
+}
+
+// parseProperty parses a property of the form 'key=value'.
+func parseProperty(s string) (key, value string, err error) {
+	key, value, ok := strings.Cut(s, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("invalid Kafka property '%v', must be 'key=value'", s)
+	}
+	return key, value, nil
+}
+
+// readConfigFile reads the librdkafka properties of a properties file. Empty
+// lines and lines starting with '#' are ignored.
+func readConfigFile(name string, m kafka.ConfigMap) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("cannot read Kafka config file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, err := parseProperty(line)
+		if err != nil {
+			return fmt.Errorf("%v:%v: %w", name, n, err)
+		}
+		m[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read Kafka config file: %w", err)
+	}
+	return nil
+}
+
+// Load validates the configuration and reads the config file. It must be
+// called before the first client is created.
+func (c *Config) Load() error {
+	m := kafka.ConfigMap{}
+
+	sasl := c.Username != "" || c.Mechanism != ""
+	if sasl {
+		if c.Username == "" {
+			return errors.New("SASL authentication requires a username")
+		}
+		mechanism := strings.ToUpper(c.Mechanism)
+		if mechanism == "" {
+			mechanism = "PLAIN"
+		}
+		supported := false
+		for _, name := range Mechanisms {
+			supported = supported || name == mechanism
+		}
+		if !supported {
+			return fmt.Errorf("unknown SASL mechanism '%v'", c.Mechanism)
+		}
+		password := c.Password
+		if password == "" {
+			password = os.Getenv(PasswordEnv)
+		}
+		m["sasl.mechanisms"] = mechanism
+		m["sasl.username"] = c.Username
+		m["sasl.password"] = password
+	}
+
+	ssl := c.CAFile != "" || c.CertFile != "" || c.KeyFile != ""
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("a client certificate requires both '-kafka-cert' and '-kafka-key'")
+	}
+	for _, file := range []string{c.CAFile, c.CertFile, c.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("cannot read certificate: %w", err)
+		}
+	}
+	if c.CAFile != "" {
+		m["ssl.ca.location"] = c.CAFile
+	}
+	if c.CertFile != "" {
+		m["ssl.certificate.location"] = c.CertFile
+		m["ssl.key.location"] = c.KeyFile
+	}
+
+	protocol := strings.ToLower(c.SecurityProtocol)
+	switch {
+	case protocol != "":
+		switch protocol {
+		case "plaintext", "ssl", "sasl_plaintext", "sasl_ssl":
+		default:
+			return fmt.Errorf("unknown Kafka security protocol '%v'", c.SecurityProtocol)
+		}
+	case sasl && ssl:
+		protocol = "sasl_ssl"
+	case sasl:
+		protocol = "sasl_plaintext"
+	case ssl:
+		protocol = "ssl"
+	}
+	if protocol != "" {
+		m["security.protocol"] = protocol
+	}
+
+	if c.ConfigFile != "" {
+		if err := readConfigFile(c.ConfigFile, m); err != nil {
+			return err
+		}
+	}
+	for _, p := range c.Properties {
+		key, value, err := parseProperty(p)
+		if err != nil {
+			return err
+		}
+		m[key] = value
+	}
+	c.properties = m
+	return nil
+}
+
+// Setup loads the configuration. If it is invalid, the application exits.
+func (c *Config) Setup() {
+	if err := c.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+}
+
+// ConfigMap returns the client configuration for the brokers, which consists
+// of the properties of the application in base, overridden by the security
+// settings and additional properties of c. c may be nil.
+func (c *Config) ConfigMap(brokers string, base kafka.ConfigMap) *kafka.ConfigMap {
+	m := kafka.ConfigMap{"bootstrap.servers": brokers}
+	for k, v := range base {
+		m[k] = v
+	}
+	if c != nil {
+		for k, v := range c.properties {
+			m[k] = v
+		}
+	}
+	return &m
+}
+
+// NewConsumer creates a consumer for the brokers, see ConfigMap.
+func (c *Config) NewConsumer(brokers string, base kafka.ConfigMap) (*kafka.Consumer, error) {
+	return kafka.NewConsumer(c.ConfigMap(brokers, base))
+}
+
+// NewProducer creates a producer for the brokers, see ConfigMap.
+func (c *Config) NewProducer(brokers string, base kafka.ConfigMap) (*kafka.Producer, error) {
+	return kafka.NewProducer(c.ConfigMap(brokers, base))
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Config holds the logging configuration of an application, usually set from
+// the command line interface.
+type Config struct {
+	Level  string
+	Format string
+}
+
+// RegisterFlags registers the '-log-level' and '-log-format' flags on the
+// default flag set and returns the Config the values are written to.
+// Call Setup after flag.Parse() to apply the configuration.
+func RegisterFlags(defaultLevel string) *Config {
+	c := &Config{}
+	flag.StringVar(&c.Level, "log-level", defaultLevel,
+		"Log level, one of 'debug', 'info', 'warn' or 'error'.")
+	flag.StringVar(&c.Format, "log-format", "text",
+		"Log format, either 'text' or 'json'.")
+	return c
+}
+
+// parseLevel converts a level name into a slog.Level.
+func parseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level '%v'", level)
+}
+
+// New creates a new logger writing to w. Every record of the logger
+// contains the component field, e.g. the name of the application.
+func (c *Config) New(w io.Writer, component string) (*slog.Logger, error) {
+	level, err := parseLevel(c.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(c.Format) {
+	case "text", "":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format '%v'", c.Format)
+	}
+
+	return slog.New(handler).With("component", component), nil
+}
+
+// Setup creates a new logger writing to stderr and sets it as the default
+// logger, so that slog's package level functions and the standard log
+// package use it. If the configuration is invalid, the application exits.
+func (c *Config) Setup(component string) *slog.Logger {
+	logger, err := c.New(os.Stderr, component)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	slog.SetDefault(logger)
+	return logger
+}
+
+// Fatal logs msg at error level with the default logger and exits the
+// application.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
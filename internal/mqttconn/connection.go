@@ -0,0 +1,203 @@
+package mqttconn
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// A State is the state of a Connection.
+type State int
+
+const (
+	Disconnected State = iota
+	Connecting
+	Connected
+	Reconnecting
+)
+
+func (s State) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Reconnecting:
+		return "reconnecting"
+	}
+	return "disconnected"
+}
+
+// ErrStopped is returned by Connect if it was stopped before the connection
+// was established.
+var ErrStopped = errors.New("connect stopped")
+
+// subscription is a subscription restored on each connect.
+type subscription struct {
+	qos     byte
+	handler mqtt.MessageHandler
+}
+
+// A Connection is an MQTT client that reconnects automatically with
+// exponential backoff and restores its subscriptions on each connect, even
+// if the broker doesn't keep the session. It is safe for concurrent use.
+type Connection struct {
+	mqtt.Client
+
+	maxInterval   time.Duration
+	onStateChange func(s State, err error)
+
+	mu            sync.Mutex
+	state         State
+	subscriptions map[string]subscription
+}
+
+// NewConnection creates a connection with the options opts, see
+// Config.Options. onStateChange is called on each state change with the
+// error causing it, if any. It may be nil.
+//
+// The OnConnect, ConnectionLost and Reconnecting handlers of opts are
+// replaced.
+func NewConnection(opts *mqtt.ClientOptions, onStateChange func(s State, err error)) *Connection {
+	c := &Connection{
+		maxInterval:   opts.MaxReconnectInterval,
+		onStateChange: onStateChange,
+		subscriptions: map[string]subscription{},
+	}
+	opts.SetAutoReconnect(true)
+	opts.SetOnConnectHandler(func(mqtt.Client) {
+		c.setState(Connected, nil)
+		c.restore()
+	})
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		c.setState(Reconnecting, err)
+	})
+	opts.SetReconnectingHandler(func(mqtt.Client, *mqtt.ClientOptions) {
+		c.setState(Reconnecting, nil)
+	})
+	c.Client = mqtt.NewClient(opts)
+	return c
+}
+
+// setState sets the state and reports it.
+func (c *Connection) setState(s State, err error) {
+	c.mu.Lock()
+	changed := c.state != s
+	c.state = s
+	c.mu.Unlock()
+
+	if !changed && err == nil {
+		return
+	}
+	switch {
+	case err != nil:
+		slog.Warn("connection to broker lost", "state", s, "err", err)
+	case s == Connected:
+		slog.Info("connected to broker")
+	default:
+		slog.Info("connection state changed", "state", s)
+	}
+	if c.onStateChange != nil {
+		c.onStateChange(s, err)
+	}
+}
+
+// State returns the current state of the connection.
+func (c *Connection) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Connect connects to the broker. If the broker isn't reachable, it retries
+// with exponential backoff from one second up to the maximum reconnect
+// interval of the options, until it succeeds or stop is closed. stop may be
+// nil.
+func (c *Connection) Connect(stop <-chan struct{}) error {
+	c.setState(Connecting, nil)
+	backoff := time.Second
+	for {
+		token := c.Client.Connect()
+		token.Wait()
+		err := token.Error()
+		if err == nil {
+			return nil
+		}
+
+		slog.Warn("cannot connect to broker, retrying", "in", backoff, "err", err)
+		select {
+		case <-stop:
+			c.setState(Disconnected, nil)
+			return ErrStopped
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; c.maxInterval > 0 && backoff > c.maxInterval {
+			backoff = c.maxInterval
+		}
+	}
+}
+
+// restore subscribes all topics of the connection. It is called on each
+// connect.
+func (c *Connection) restore() {
+	c.mu.Lock()
+	subscriptions := make(map[string]subscription, len(c.subscriptions))
+	for topic, s := range c.subscriptions {
+		subscriptions[topic] = s
+	}
+	c.mu.Unlock()
+
+	for topic, s := range subscriptions {
+		if token := c.Client.Subscribe(topic, s.qos, s.handler); token.Wait() && token.Error() != nil {
+			slog.Error("cannot restore subscription", "topic", topic, "err", token.Error())
+		} else {
+			slog.Debug("subscription restored", "topic", topic)
+		}
+	}
+}
+
+// Subscribe subscribes topic and restores the subscription on each connect.
+// If the connection isn't established yet, the topic is subscribed as soon
+// as it is. handler may be nil to use the default publish handler.
+func (c *Connection) Subscribe(topic string, qos byte, handler mqtt.MessageHandler) error {
+	c.mu.Lock()
+	c.subscriptions[topic] = subscription{qos, handler}
+	connected := c.state == Connected
+	c.mu.Unlock()
+
+	if !connected {
+		return nil
+	}
+	if token := c.Client.Subscribe(topic, qos, handler); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+// Unsubscribe unsubscribes the topics, which are no longer restored.
+func (c *Connection) Unsubscribe(topics ...string) error {
+	c.mu.Lock()
+	for _, topic := range topics {
+		delete(c.subscriptions, topic)
+	}
+	connected := c.state == Connected
+	c.mu.Unlock()
+
+	if !connected {
+		return nil
+	}
+	if token := c.Client.Unsubscribe(topics...); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+// Disconnect disconnects from the broker after waiting quiesce milliseconds
+// for outstanding work.
+func (c *Connection) Disconnect(quiesce uint) {
+	c.Client.Disconnect(quiesce)
+	c.setState(Disconnected, nil)
+}
@@ -0,0 +1,215 @@
+package mqttconn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// PasswordEnv is the environment variable the password is read from, if the
+// '-mqtt-password' flag isn't set. This keeps the password out of the
+// process list.
+const PasswordEnv = "MQTT_PASSWORD"
+
+// Config holds the connection configuration of an MQTT client, usually set
+// from the command line interface.
+type Config struct {
+	// Brokers is a comma separated list of broker URLs. The client connects
+	// to the first reachable broker in the given order.
+	Brokers  string
+	Username string
+	Password string
+	// CAFile is a PEM file with the certificates to verify the broker with.
+	// The system certificates are used if empty.
+	CAFile string
+	// CertFile and KeyFile are PEM files with the client certificate and its
+	// private key, if the broker authenticates clients by certificate.
+	CertFile string
+	KeyFile  string
+	// Insecure disables the verification of the broker certificate.
+	Insecure bool
+	// MaxReconnectInterval is the maximum time between two connection
+	// attempts. The interval starts at one second and doubles after each
+	// failed attempt. Uses the default of the MQTT client if 0.
+	MaxReconnectInterval time.Duration
+}
+
+// RegisterFlags registers the '-mqtt-*' connection flags on the default flag
+// set and returns the Config the values are written to. Call Options after
+// flag.Parse() to create the client options.
+func RegisterFlags(defaultBroker string) *Config {
+	c := &Config{}
+	flag.StringVar(&c.Brokers, "mqtt-broker", defaultBroker,
+		"Comma separated list of MQTT broker URLs, e.g. 'ssl://host:8883', tried in order.")
+	flag.StringVar(&c.Username, "mqtt-username", "", "Username to authenticate with at the broker.")
+	flag.StringVar(&c.Password, "mqtt-password", "",
+		fmt.Sprintf("Password to authenticate with at the broker, defaults to $%v.", PasswordEnv))
+	flag.StringVar(&c.CAFile, "mqtt-ca", "", "PEM file with the CA certificates to verify the broker.")
+	flag.StringVar(&c.CertFile, "mqtt-cert", "", "PEM file with the client certificate.")
+	flag.StringVar(&c.KeyFile, "mqtt-key", "", "PEM file with the private key of the client certificate.")
+	flag.BoolVar(&c.Insecure, "mqtt-insecure", false,
+		"Don't verify the broker certificate. Use for testing only.")
+	flag.DurationVar(&c.MaxReconnectInterval, "mqtt-max-reconnect-interval", 30*time.Second,
+		"Maximum time between two attempts to (re)connect to the broker.")
+	return c
+}
+
+// defaultPorts are the ports used if a broker URL doesn't contain one.
+var defaultPorts = map[string]string{
+	"tcp":   "1883",
+	"mqtt":  "1883",
+	"ssl":   "8883",
+	"tls":   "8883",
+	"mqtts": "8883",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// ParseBroker parses a broker URL. The scheme defaults to 'tcp' and the port
+// to the default port of the scheme, e.g. 'broker' is 'tcp://broker:1883'.
+// Supported schemes are 'tcp', 'mqtt', 'ssl', 'tls', 'mqtts', 'ws' and 'wss'.
+func ParseBroker(s string) (*url.URL, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		s = "tcp://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker URL '%v': %w", s, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	port, ok := defaultPorts[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("invalid broker URL '%v': unsupported scheme '%v'", s, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid broker URL '%v': missing host", s)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+// ValidateTopicFilter checks the wildcards of an MQTT topic filter: '+' must
+// be a whole level and '#' the whole last level.
+func ValidateTopicFilter(topic string) error {
+	levels := strings.Split(topic, "/")
+	for i, level := range levels {
+		switch {
+		case level == "#" && i != len(levels)-1:
+			return fmt.Errorf("invalid topic '%v': '#' must be the last level", topic)
+		case level != "+" && level != "#" && strings.ContainsAny(level, "+#"):
+			return fmt.Errorf("invalid topic '%v': wildcards must be a whole level", topic)
+		}
+	}
+	return nil
+}
+
+// secure reports whether the scheme of u uses TLS.
+func secure(u *url.URL) bool {
+	switch u.Scheme {
+	case "ssl", "tls", "mqtts", "wss":
+		return true
+	}
+	return false
+}
+
+// TLSConfig creates the TLS configuration from the certificate files.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: c.Insecure}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificates: %w", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in '%v'", c.CAFile)
+		}
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("a client certificate requires both '-mqtt-cert' and '-mqtt-key'")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// Options creates the client options for the brokers, credentials and TLS
+// configuration. The caller sets the options of the application, e.g. the
+// client ID and handlers, before creating the client.
+func (c *Config) Options() (*mqtt.ClientOptions, error) {
+	opts := mqtt.NewClientOptions()
+	// The client dials plain connections for brokers without a TLS scheme,
+	// even if a TLS configuration is set. Reject them instead of sending the
+	// credentials unencrypted.
+	tlsFlags := c.CAFile != "" || c.CertFile != "" || c.KeyFile != "" || c.Insecure
+	useTLS := false
+	for _, broker := range strings.Split(c.Brokers, ",") {
+		if strings.TrimSpace(broker) == "" {
+			continue
+		}
+		u, err := ParseBroker(broker)
+		if err != nil {
+			return nil, err
+		}
+		if tlsFlags && !secure(u) {
+			return nil, fmt.Errorf("broker '%v' doesn't use TLS, use a scheme like 'ssl://' or 'wss://' with the TLS flags", u)
+		}
+		useTLS = useTLS || secure(u)
+		opts.AddBroker(u.String())
+	}
+	if len(opts.Servers) == 0 {
+		return nil, errors.New("you must specify an MQTT broker")
+	}
+	if c.MaxReconnectInterval < 0 {
+		return nil, errors.New("the maximum reconnect interval must not be negative")
+	}
+	if c.MaxReconnectInterval > 0 {
+		opts.SetMaxReconnectInterval(c.MaxReconnectInterval)
+	}
+
+	if c.Username != "" {
+		opts.SetUsername(c.Username)
+		password := c.Password
+		if password == "" {
+			password = os.Getenv(PasswordEnv)
+		}
+		opts.SetPassword(password)
+	}
+	if useTLS {
+		conf, err := c.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(conf)
+	}
+	return opts, nil
+}
+
+// Setup creates the client options. If the configuration is invalid, the
+// application exits.
+func (c *Config) Setup() *mqtt.ClientOptions {
+	opts, err := c.Options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	return opts
+}
@@ -0,0 +1,56 @@
+package mqttconn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Levels splits an MQTT topic into its levels. A leading '/' doesn't start an
+// empty level, so the levels of '/weather/mosbach' are 'weather' and
+// 'mosbach'.
+func Levels(topic string) []string {
+	return strings.Split(strings.TrimPrefix(topic, "/"), "/")
+}
+
+// A Level selects a level of an MQTT topic, see Levels. Positive levels count
+// from the first level, which is 1, negative levels from the last level,
+// which is -1. Level 0 selects the whole topic.
+type Level int
+
+// ParseLevel parses a level, which is a number or 'topic' for the whole
+// topic.
+func ParseLevel(s string) (Level, error) {
+	if s == "topic" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid topic level '%v', must be a number or 'topic'", s)
+	}
+	return Level(n), nil
+}
+
+// Of returns the level of topic. ok is false if the topic has not enough
+// levels.
+func (l Level) Of(topic string) (level string, ok bool) {
+	if l == 0 {
+		return topic, true
+	}
+	levels := Levels(topic)
+	i := int(l) - 1
+	if l < 0 {
+		i = len(levels) + int(l)
+	}
+	if i < 0 || i >= len(levels) {
+		return "", false
+	}
+	return levels[i], true
+}
+
+func (l Level) String() string {
+	if l == 0 {
+		return "topic"
+	}
+	return strconv.Itoa(int(l))
+}
@@ -0,0 +1,276 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+)
+
+// Formats contains the names of all output formats.
+var Formats = []string{"text", "table", "line", "json", "ndjson", "csv", "template"}
+
+// Config holds the output configuration of a weather data printer, usually
+// set from the command line interface.
+type Config struct {
+	Format   string
+	Template string
+	Unit     string
+}
+
+// RegisterFlags registers the '-output', '-template' and '-unit' flags on
+// the default flag set and returns the Config the values are written to.
+// Call Setup after flag.Parse() to create the printer.
+func RegisterFlags() *Config {
+	c := &Config{}
+	flag.StringVar(&c.Format, "output", "text",
+		fmt.Sprintf("Output format, one of '%v'.", strings.Join(Formats, "', '")))
+	flag.StringVar(&c.Template, "template", "",
+		"Go template for the 'template' output, or '@<file>' to read it from a file.")
+	flag.StringVar(&c.Unit, "unit", string(data.Celsius),
+		"Temperature unit to print, 'C', 'F' or 'K'. JSON output is always in 'C'.")
+	return c
+}
+
+// A Printer prints weather data records. Printers are safe for concurrent
+// use.
+type Printer interface {
+	Print(w *data.WeatherData) error
+}
+
+// A PrinterFunc is a function used as Printer.
+type PrinterFunc func(w *data.WeatherData) error
+
+func (f PrinterFunc) Print(w *data.WeatherData) error {
+	return f(w)
+}
+
+// lockedPrinter serializes the calls of a printer, so records aren't mixed
+// if they are printed from different goroutines.
+type lockedPrinter struct {
+	mu sync.Mutex
+	p  Printer
+}
+
+func (l *lockedPrinter) Print(w *data.WeatherData) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.p.Print(w)
+}
+
+// New creates a printer writing to out.
+func (c *Config) New(out io.Writer) (Printer, error) {
+	unit, err := data.ParseUnit(c.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Printer
+	switch strings.ToLower(c.Format) {
+	case "text", "":
+		p = PrinterFunc(func(w *data.WeatherData) error {
+			_, err := fmt.Fprintln(out, w.Format(unit))
+			return err
+		})
+	case "table":
+		p = newTablePrinter(out, unit)
+	case "line":
+		p = PrinterFunc(func(w *data.WeatherData) error {
+			_, err := fmt.Fprintln(out, Line(w, unit))
+			return err
+		})
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		p = PrinterFunc(func(w *data.WeatherData) error { return enc.Encode(w) })
+	case "ndjson":
+		enc := json.NewEncoder(out)
+		p = PrinterFunc(func(w *data.WeatherData) error { return enc.Encode(w) })
+	case "csv":
+		p = newCSVPrinter(out, unit)
+	case "template":
+		if p, err = newTemplatePrinter(out, c.Template, unit); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown output format '%v'", c.Format)
+	}
+	return &lockedPrinter{p: p}, nil
+}
+
+// Setup creates a printer writing to stdout. If the configuration is
+// invalid, the application exits.
+func (c *Config) Setup() Printer {
+	p, err := c.New(os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	return p
+}
+
+// number formats f rounded to two decimal places.
+func number(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
+
+// optional formats the optional value v, or returns empty if it is nil.
+func optional(v *float64, empty string) string {
+	if v == nil {
+		return empty
+	}
+	return number(*v)
+}
+
+// Line returns the weather data record w as single line with temperatures in
+// the unit u, e.g.:
+//
+//	2022-05-06T12:10:10.124+02:00 Mosbach 18.53°C (min 18.1°C, max 20.37°C, feels like 18.53°C)
+func Line(w *data.WeatherData, u data.Unit) string {
+	temp := func(c float64) string { return number(u.FromCelsius(c)) + u.Symbol() }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v %v %v (min %v, max %v, feels like %v",
+		w.TimeStamp.Format(data.TimestampFormat), w.City, temp(w.TempCurrent),
+		temp(w.TempMin), temp(w.TempMax), temp(w.FeelsLike()))
+	if w.Humidity != nil {
+		fmt.Fprintf(&b, ", humidity %v%%", number(*w.Humidity))
+	}
+	if w.Pressure != nil {
+		fmt.Fprintf(&b, ", pressure %v hPa", number(*w.Pressure))
+	}
+	if w.WindSpeed != nil {
+		fmt.Fprintf(&b, ", wind %v m/s", number(*w.WindSpeed))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// tablePrinter prints records as rows of a table with fixed column widths,
+// so the table can be printed while the records arrive. The header is
+// printed before the first record.
+type tablePrinter struct {
+	out    io.Writer
+	unit   data.Unit
+	header bool
+}
+
+const tableRow = "%-29s  %-18s  %8s  %8s  %8s  %10s  %8s  %8s  %8s\n"
+
+func newTablePrinter(out io.Writer, unit data.Unit) *tablePrinter {
+	return &tablePrinter{out: out, unit: unit}
+}
+
+func (t *tablePrinter) Print(w *data.WeatherData) error {
+	if !t.header {
+		t.header = true
+		s := t.unit.Symbol()
+		if _, err := fmt.Fprintf(t.out, tableRow, "TIME", "CITY", "CUR "+s, "MIN "+s,
+			"MAX "+s, "FEELS "+s, "HUM %", "HPA", "WIND M/S"); err != nil {
+			return err
+		}
+	}
+	temp := func(c float64) string { return number(t.unit.FromCelsius(c)) }
+	_, err := fmt.Fprintf(t.out, tableRow, w.TimeStamp.Format(data.TimestampFormat),
+		w.City, temp(w.TempCurrent), temp(w.TempMin), temp(w.TempMax),
+		temp(w.FeelsLike()), optional(w.Humidity, "-"), optional(w.Pressure, "-"),
+		optional(w.WindSpeed, "-"))
+	return err
+}
+
+// csvPrinter prints records as CSV with a header line. Missing optional
+// values are empty.
+type csvPrinter struct {
+	w      *csv.Writer
+	unit   data.Unit
+	header bool
+}
+
+func newCSVPrinter(out io.Writer, unit data.Unit) *csvPrinter {
+	return &csvPrinter{w: csv.NewWriter(out), unit: unit}
+}
+
+func (c *csvPrinter) Print(w *data.WeatherData) error {
+	if !c.header {
+		c.header = true
+		c.w.Write([]string{"timeStamp", "city", "cityId", "tempCurrent", "tempMin",
+			"tempMax", "tempUnit", "feelsLike", "dewPoint", "humidity", "pressure",
+			"windSpeed", "windDirection", "comment"})
+	}
+
+	temp := func(t float64) string { return number(c.unit.FromCelsius(t)) }
+	dewPoint := ""
+	if d, ok := w.DewPoint(); ok {
+		dewPoint = temp(d)
+	}
+	c.w.Write([]string{
+		w.TimeStamp.Format(data.TimestampFormat),
+		w.City,
+		strconv.Itoa(w.CityID),
+		temp(w.TempCurrent),
+		temp(w.TempMin),
+		temp(w.TempMax),
+		string(c.unit),
+		temp(w.FeelsLike()),
+		dewPoint,
+		optional(w.Humidity, ""),
+		optional(w.Pressure, ""),
+		optional(w.WindSpeed, ""),
+		optional(w.WindDirection, ""),
+		w.Comment,
+	})
+	// Flush after each record, so the output can be piped.
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// newTemplatePrinter creates a printer executing the Go template tmpl for
+// each record. If tmpl starts with '@', the template is read from the file
+// with the given name. A newline is appended to each record, if the template
+// doesn't end with one.
+//
+// The template is executed with the data.WeatherData record, e.g.
+// '{{.City}}: {{temp .TempCurrent}}'. The following functions are available:
+//
+//	temp    converts a temperature to the selected unit
+//	unit    returns the symbol of the selected unit, e.g. '°C'
+//	time    formats a time with a Go layout, e.g. '{{time .TimeStamp "15:04"}}'
+//	round   rounds a number to two decimal places
+func newTemplatePrinter(out io.Writer, tmpl string, unit data.Unit) (Printer, error) {
+	if strings.HasPrefix(tmpl, "@") {
+		b, err := os.ReadFile(tmpl[1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot read template: %w", err)
+		}
+		tmpl = string(b)
+	}
+	if tmpl == "" {
+		return nil, errors.New("the 'template' output requires a template")
+	}
+	if !strings.HasSuffix(tmpl, "\n") {
+		tmpl += "\n"
+	}
+
+	t, err := template.New("output").Funcs(template.FuncMap{
+		"temp":  func(c float64) float64 { return math.Round(unit.FromCelsius(c)*100) / 100 },
+		"unit":  unit.Symbol,
+		"time":  func(t time.Time, layout string) string { return t.Format(layout) },
+		"round": func(f float64) float64 { return math.Round(f*100) / 100 },
+	}).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return PrinterFunc(func(w *data.WeatherData) error { return t.Execute(out, w) }), nil
+}
@@ -0,0 +1,323 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Registry stores versioned schemas of subjects.
+type Registry interface {
+	// Register registers the definition as new version of subject and
+	// returns the registered schema. If the definition is already
+	// registered for subject, the existing schema is returned.
+	Register(subject, definition string) (*Schema, error)
+	// SchemaByID returns the schema with the given ID.
+	SchemaByID(id int) (*Schema, error)
+	// Latest returns the latest version of subject.
+	Latest(subject string) (*Schema, error)
+}
+
+// RegisterFlag registers the '-schema-registry' flag on the default flag set
+// and returns the location the value is written to. Use Open to open the
+// registry after flag.Parse().
+func RegisterFlag() *string {
+	return flag.String("schema-registry", "",
+		"URL of a schema registry or path of a local registry file. Disabled if empty.")
+}
+
+// Open opens the registry at location. If location is an HTTP(S) URL, a
+// client for a Confluent compatible schema registry is returned, otherwise
+// location is the path of a local registry file, which is created if it
+// doesn't exist. If location is empty, Open returns nil.
+func Open(location string) (Registry, error) {
+	if location == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return NewClient(location), nil
+	}
+	return OpenFile(location)
+}
+
+// RegisterLatest registers the latest embedded definition of subject in r.
+func RegisterLatest(r Registry, subject string) (*Schema, error) {
+	definition, err := Definition(subject, LatestVersion(subject))
+	if err != nil {
+		return nil, err
+	}
+	return r.Register(subject, definition)
+}
+
+// compact removes insignificant whitespace from a JSON definition, so
+// definitions can be compared.
+func compact(definition string) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, []byte(definition)); err != nil {
+		return definition
+	}
+	return b.String()
+}
+
+// A FileRegistry is a registry stored in a local JSON file. It can be used
+// as stand-in for a schema registry during development. New versions of a
+// subject must be backward compatible to the previous version, see
+// Schema.CheckBackward.
+type FileRegistry struct {
+	mu      sync.Mutex
+	path    string
+	schemas []*Schema
+}
+
+// OpenFile opens the registry file at path. If the file doesn't exist, it
+// is created on the first registration.
+func OpenFile(path string) (*FileRegistry, error) {
+	r := &FileRegistry{path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read schema registry file: %w", err)
+	}
+	if err := json.Unmarshal(b, &r.schemas); err != nil {
+		return nil, fmt.Errorf("cannot parse schema registry file '%v': %w", path, err)
+	}
+	return r, nil
+}
+
+// save writes the registry to its file. The file is replaced atomically, so
+// it stays intact if writing fails.
+func (r *FileRegistry) save() error {
+	b, err := json.MarshalIndent(r.schemas, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), ".schemas-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+func (r *FileRegistry) latest(subject string) *Schema {
+	var latest *Schema
+	for _, s := range r.schemas {
+		if s.Subject == subject && (latest == nil || s.Version > latest.Version) {
+			latest = s
+		}
+	}
+	return latest
+}
+
+func (r *FileRegistry) Register(subject, definition string) (*Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	definition = compact(definition)
+	for _, s := range r.schemas {
+		if s.Subject == subject && s.Definition == definition {
+			return s, nil
+		}
+	}
+
+	s := &Schema{Subject: subject, Version: 1, Definition: definition}
+	if latest := r.latest(subject); latest != nil {
+		if err := s.CheckBackward(latest); err != nil {
+			return nil, fmt.Errorf("schema is incompatible to version %v of subject '%v': %w",
+				latest.Version, subject, err)
+		}
+		s.Version = latest.Version + 1
+	} else if _, err := s.parse(); err != nil {
+		return nil, err
+	}
+	for _, existing := range r.schemas {
+		if existing.ID >= s.ID {
+			s.ID = existing.ID + 1
+		}
+	}
+	if s.ID == 0 {
+		s.ID = 1
+	}
+
+	r.schemas = append(r.schemas, s)
+	if err := r.save(); err != nil {
+		r.schemas = r.schemas[:len(r.schemas)-1]
+		return nil, fmt.Errorf("cannot write schema registry file: %w", err)
+	}
+	return s, nil
+}
+
+func (r *FileRegistry) SchemaByID(id int) (*Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.schemas {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("schema %v not found", id)
+}
+
+func (r *FileRegistry) Latest(subject string) (*Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s := r.latest(subject); s != nil {
+		return s, nil
+	}
+	return nil, fmt.Errorf("subject '%v' not found", subject)
+}
+
+// A Client is a client for the REST API of a Confluent compatible schema
+// registry. Schemas are cached, because they never change once registered.
+type Client struct {
+	url  string
+	http *http.Client
+
+	mu    sync.Mutex
+	byID  map[int]*Schema
+	byDef map[string]*Schema
+}
+
+func NewClient(url string) *Client {
+	return &Client{
+		url:   strings.TrimSuffix(url, "/"),
+		http:  &http.Client{Timeout: 10 * time.Second},
+		byID:  map[int]*Schema{},
+		byDef: map[string]*Schema{},
+	}
+}
+
+// do sends a request to the registry and decodes the JSON response into v.
+func (c *Client) do(method, path string, body, v any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.url+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("schema registry request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Code    int    `json:"error_code"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("schema registry request %v %v failed with status %v: %v",
+			method, path, resp.StatusCode, e.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) cache(s *Schema) *Schema {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.byID[s.ID]; ok && cached.Subject == s.Subject {
+		return cached
+	}
+	c.byID[s.ID] = s
+	c.byDef[s.Subject+"\x00"+compact(s.Definition)] = s
+	return s
+}
+
+func (c *Client) Register(subject, definition string) (*Schema, error) {
+	key := subject + "\x00" + compact(definition)
+	c.mu.Lock()
+	s, ok := c.byDef[key]
+	c.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	body := map[string]string{"schema": definition, "schemaType": "JSON"}
+	path := fmt.Sprintf("/subjects/%v/versions", url.PathEscape(subject))
+	var registered struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(http.MethodPost, path, body, &registered); err != nil {
+		return nil, err
+	}
+
+	// The registration only returns the ID, so look up the version.
+	s = &Schema{}
+	path = fmt.Sprintf("/subjects/%v", url.PathEscape(subject))
+	if err := c.do(http.MethodPost, path, body, s); err != nil {
+		return nil, err
+	}
+	return c.cache(s), nil
+}
+
+func (c *Client) SchemaByID(id int) (*Schema, error) {
+	c.mu.Lock()
+	s, ok := c.byID[id]
+	c.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	var schema struct {
+		Schema string `json:"schema"`
+	}
+	if err := c.do(http.MethodGet, fmt.Sprintf("/schemas/ids/%v", id), nil, &schema); err != nil {
+		return nil, err
+	}
+	var versions []struct {
+		Subject string `json:"subject"`
+		Version int    `json:"version"`
+	}
+	if err := c.do(http.MethodGet, fmt.Sprintf("/schemas/ids/%v/versions", id), nil, &versions); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("schema %v isn't registered for any subject", id)
+	}
+
+	return c.cache(&Schema{
+		ID:         id,
+		Subject:    versions[0].Subject,
+		Version:    versions[0].Version,
+		Definition: schema.Schema,
+	}), nil
+}
+
+func (c *Client) Latest(subject string) (*Schema, error) {
+	s := &Schema{}
+	path := fmt.Sprintf("/subjects/%v/versions/latest", url.PathEscape(subject))
+	if err := c.do(http.MethodGet, path, nil, s); err != nil {
+		return nil, err
+	}
+	return c.cache(s), nil
+}
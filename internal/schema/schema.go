@@ -0,0 +1,372 @@
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Subjects of the payloads used in this project. The names follow the
+// '<topic>-value' convention of the Confluent Schema Registry.
+const (
+	WeatherSubject      = "weather-value"
+	TankerkoenigSubject = "tankerkoenig-value"
+)
+
+// MagicByte is the first byte of a framed payload, followed by the schema ID
+// as 4 byte big endian integer. This is the wire format of the Confluent
+// Schema Registry. JSON payloads never start with this byte, so framed and
+// unframed payloads can be distinguished.
+const MagicByte = 0x0
+
+//go:embed definitions/*.json
+var definitions embed.FS
+
+// Definition returns the embedded JSON Schema definition of version of
+// subject.
+func Definition(subject string, version int) (string, error) {
+	b, err := definitions.ReadFile(fmt.Sprintf("definitions/%v.v%v.json", subject, version))
+	if err != nil {
+		return "", fmt.Errorf("no definition for version %v of subject '%v'", version, subject)
+	}
+	return string(b), nil
+}
+
+// LatestVersion returns the latest version of subject with an embedded
+// definition, or 0 if there is none.
+func LatestVersion(subject string) int {
+	version := 0
+	for {
+		if _, err := Definition(subject, version+1); err != nil {
+			return version
+		}
+		version++
+	}
+}
+
+// A Schema is a registered version of a JSON Schema definition.
+type Schema struct {
+	ID         int    `json:"id"`
+	Subject    string `json:"subject"`
+	Version    int    `json:"version"`
+	Definition string `json:"schema"`
+
+	once sync.Once
+	root *node
+	err  error
+}
+
+// Embedded returns the embedded definition of version of subject as Schema.
+// Embedded schemas aren't registered, so their ID is 0.
+func Embedded(subject string, version int) (*Schema, error) {
+	definition, err := Definition(subject, version)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{Subject: subject, Version: version, Definition: definition}, nil
+}
+
+// A node is a parsed JSON Schema. Only the keywords 'type', 'properties',
+// 'required', 'additionalProperties', 'items', 'enum', 'pattern', 'minimum'
+// and 'maximum' are validated, all other keywords are ignored.
+type node struct {
+	Type                 any              `json:"type"`
+	Properties           map[string]*node `json:"properties"`
+	Required             []string         `json:"required"`
+	AdditionalProperties *bool            `json:"additionalProperties"`
+	Items                *node            `json:"items"`
+	Enum                 []any            `json:"enum"`
+	Pattern              string           `json:"pattern"`
+	Minimum              *float64         `json:"minimum"`
+	Maximum              *float64         `json:"maximum"`
+
+	pattern *regexp.Regexp
+}
+
+func (n *node) compile() error {
+	if n.Pattern != "" {
+		p, err := regexp.Compile(n.Pattern)
+		if err != nil {
+			return err
+		}
+		n.pattern = p
+	}
+	for _, p := range n.Properties {
+		if err := p.compile(); err != nil {
+			return err
+		}
+	}
+	if n.Items != nil {
+		return n.Items.compile()
+	}
+	return nil
+}
+
+// types returns the allowed types of the node, or nil if all types are
+// allowed.
+func (n *node) types() []string {
+	switch t := n.Type.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// allowsTypes reports whether the node allows all of types. A nil slice
+// allows all types.
+func (n *node) allowsTypes(types []string) bool {
+	allowed := n.types()
+	if allowed == nil {
+		return true
+	}
+	if types == nil {
+		return false
+	}
+	for _, t := range types {
+		ok := false
+		for _, a := range allowed {
+			if t == a || (a == "number" && t == "integer") {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// typeOf returns the JSON Schema type of a value decoded with UseNumber.
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+func (n *node) validate(path string, v any) error {
+	if types := n.types(); types != nil {
+		actual := typeOf(v)
+		ok := false
+		for _, t := range types {
+			// Integers are numbers as well.
+			if t == actual || (t == "number" && actual == "integer") {
+				ok = true
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%v: expected %v, got %v", path, strings.Join(types, " or "), actual)
+		}
+	}
+
+	if len(n.Enum) > 0 {
+		found := false
+		for _, e := range n.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%v: value %v not allowed", path, v)
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			return fmt.Errorf("%v: '%v' doesn't match pattern '%v'", path, v, n.Pattern)
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if n.Minimum != nil && f < *n.Minimum {
+			return fmt.Errorf("%v: %v is less than %v", path, f, *n.Minimum)
+		}
+		if n.Maximum != nil && f > *n.Maximum {
+			return fmt.Errorf("%v: %v is greater than %v", path, f, *n.Maximum)
+		}
+	case []any:
+		if n.Items != nil {
+			for i, item := range v {
+				if err := n.Items.validate(fmt.Sprintf("%v[%v]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]any:
+		for _, name := range n.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%v: missing required property '%v'", path, name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p, ok := n.Properties[name]
+			if !ok {
+				if n.AdditionalProperties != nil && !*n.AdditionalProperties {
+					return fmt.Errorf("%v: property '%v' not allowed", path, name)
+				}
+				continue
+			}
+			if err := p.validate(path+"."+name, v[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parse parses the definition of the schema once.
+func (s *Schema) parse() (*node, error) {
+	s.once.Do(func() {
+		var root node
+		if err := json.Unmarshal([]byte(s.Definition), &root); err != nil {
+			s.err = fmt.Errorf("invalid definition of schema '%v' version %v: %w",
+				s.Subject, s.Version, err)
+			return
+		}
+		if err := root.compile(); err != nil {
+			s.err = fmt.Errorf("invalid definition of schema '%v' version %v: %w",
+				s.Subject, s.Version, err)
+			return
+		}
+		s.root = &root
+	})
+	return s.root, s.err
+}
+
+// Validate validates the JSON payload against the schema.
+func (s *Schema) Validate(payload []byte) error {
+	root, err := s.parse()
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	return root.validate("$", v)
+}
+
+// CheckBackward checks that consumers using the schema s can read payloads
+// written with the schema old. This is the case if s doesn't require
+// properties old doesn't require and allows at least the types old allows
+// for existing properties.
+func (s *Schema) CheckBackward(old *Schema) error {
+	root, err := s.parse()
+	if err != nil {
+		return err
+	}
+	oldRoot, err := old.parse()
+	if err != nil {
+		return err
+	}
+
+	oldRequired := map[string]bool{}
+	for _, name := range oldRoot.Required {
+		oldRequired[name] = true
+	}
+	for _, name := range root.Required {
+		if !oldRequired[name] {
+			return fmt.Errorf("new required property '%v'", name)
+		}
+	}
+	for name, p := range root.Properties {
+		oldP, ok := oldRoot.Properties[name]
+		if ok && !p.allowsTypes(oldP.types()) {
+			return fmt.Errorf("type of property '%v' narrowed from %v to %v",
+				name, oldP.types(), p.types())
+		}
+	}
+	return nil
+}
+
+// Frame prepends the wire header with the schema ID id to payload.
+func Frame(id int, payload []byte) []byte {
+	b := make([]byte, 5, 5+len(payload))
+	b[0] = MagicByte
+	binary.BigEndian.PutUint32(b[1:], uint32(id))
+	return append(b, payload...)
+}
+
+// Unframe splits a framed payload into the schema ID and the payload. If b
+// isn't framed, framed is false and b is returned as payload.
+func Unframe(b []byte) (id int, payload []byte, framed bool, err error) {
+	if len(b) == 0 || b[0] != MagicByte {
+		return 0, b, false, nil
+	}
+	if len(b) < 5 {
+		return 0, nil, true, errors.New("framed payload too short")
+	}
+	return int(binary.BigEndian.Uint32(b[1:5])), b[5:], true, nil
+}
+
+// Resolve determines the schema of the payload b of subject and validates
+// the payload against it. Framed payloads are resolved with the registry r,
+// unframed payloads are validated against the latest embedded version of
+// subject, which accepts all earlier versions, including the format used
+// before schemas were introduced. It returns the schema and the payload
+// without the wire header.
+func Resolve(r Registry, subject string, b []byte) (*Schema, []byte, error) {
+	id, payload, framed, err := Unframe(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var s *Schema
+	if framed {
+		if r == nil {
+			return nil, nil, fmt.Errorf("payload uses schema %v, but no schema registry is configured", id)
+		}
+		if s, err = r.SchemaByID(id); err != nil {
+			return nil, nil, err
+		}
+		if s.Subject != subject {
+			return nil, nil, fmt.Errorf("payload uses schema %v of subject '%v', expected subject '%v'",
+				id, s.Subject, subject)
+		}
+	} else if s, err = Embedded(subject, LatestVersion(subject)); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.Validate(payload); err != nil {
+		return nil, nil, fmt.Errorf("payload doesn't match version %v of schema '%v': %w",
+			s.Version, subject, err)
+	}
+	return s, payload, nil
+}
@@ -0,0 +1,182 @@
+package schema
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFrame(t *testing.T) {
+	payload := []byte(`{"city":"Mosbach"}`)
+	b := Frame(258, payload)
+	if want := []byte{MagicByte, 0, 0, 1, 2}; !bytes.Equal(b[:5], want) {
+		t.Fatalf("header = %v, want %v", b[:5], want)
+	}
+
+	tests := []struct {
+		name    string
+		b       []byte
+		id      int
+		payload []byte
+		framed  bool
+		err     bool
+	}{
+		{"framed", b, 258, payload, true, false},
+		{"empty payload", Frame(1, nil), 1, []byte{}, true, false},
+		{"unframed", payload, 0, payload, false, false},
+		{"empty", nil, 0, nil, false, false},
+		{"too short", []byte{MagicByte, 0, 1}, 0, nil, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, payload, framed, err := Unframe(tt.b)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if id != tt.id || framed != tt.framed || !bytes.Equal(payload, tt.payload) {
+				t.Errorf("got (%v, %q, %v), want (%v, %q, %v)",
+					id, payload, framed, tt.id, tt.payload, tt.framed)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	weather, err := Embedded(WeatherSubject, LatestVersion(WeatherSubject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tankerkoenig, err := Embedded(TankerkoenigSubject, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		schema  *Schema
+		payload string
+		err     string
+	}{
+		{"valid", weather, `{"city":"Mosbach","timeStamp":"2022-05-06T12:10:10.124+02:00","cityId":1}`, ""},
+		{"epoch timestamp", weather, `{"city":"Mosbach","timeStamp":1651831810}`, ""},
+		{"additional property", weather, `{"city":"Mosbach","timeStamp":1,"unknown":true}`, ""},
+		{"missing required", weather, `{"timeStamp":1}`, "$: missing required property 'city'"},
+		{"wrong type", weather, `{"city":1,"timeStamp":1}`, "$.city: expected string, got integer"},
+		{"integer", weather, `{"city":"Mosbach","timeStamp":1,"cityId":1.5}`, "$.cityId: expected integer, got number"},
+		{"multiple types", weather, `{"city":"Mosbach","timeStamp":true}`, "$.timeStamp: expected string or number, got boolean"},
+		{"minimum", weather, `{"city":"Mosbach","timeStamp":1,"windSpeed":-1}`, "$.windSpeed: -1 is less than 0"},
+		{"maximum", weather, `{"city":"Mosbach","timeStamp":1,"humidity":101}`, "$.humidity: 101 is greater than 100"},
+		{"pattern", weather, `{"city":"Mosbach","timeStamp":1,"tempUnit":"X"}`, "$.tempUnit: 'X' doesn't match pattern"},
+		{"not an object", weather, `[]`, "$: expected object, got array"},
+		{"invalid JSON", weather, `{"city":`, "unexpected EOF"},
+		{"valid entry", tankerkoenig, `{"date":"2022-05-06","station":"51d4b477-a095-1aa0-e100-80009459e03a","postCode":"74821"}`, ""},
+		{"invalid post code", tankerkoenig, `{"date":"2022-05-06","station":"51d4b477-a095-1aa0-e100-80009459e03a","postCode":"7482"}`, "$.postCode: '7482' doesn't match pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schema.Validate([]byte(tt.payload))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckBackward(t *testing.T) {
+	old := &Schema{Definition: `{"properties":{"a":{"type":"integer"},"b":{"type":"string"}},"required":["a"]}`}
+	tests := []struct {
+		name       string
+		definition string
+		err        string
+	}{
+		{"unchanged", old.Definition, ""},
+		{"new optional property", `{"properties":{"a":{"type":"integer"},"c":{"type":"string"}},"required":["a"]}`, ""},
+		{"widened type", `{"properties":{"a":{"type":"number"}},"required":["a"]}`, ""},
+		{"new required property", `{"properties":{"a":{"type":"integer"}},"required":["a","b"]}`, "new required property 'b'"},
+		{"narrowed type", `{"properties":{"b":{"type":"integer"}},"required":["a"]}`, "type of property 'b' narrowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Schema{Definition: tt.definition}).CheckBackward(old)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r, err := OpenFile(filepath.Join(t.TempDir(), "schemas.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for version := 1; version <= LatestVersion(WeatherSubject); version++ {
+		definition, err := Definition(WeatherSubject, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := r.Register(WeatherSubject, definition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Version != version {
+			t.Fatalf("registered version %v, want %v", s.Version, version)
+		}
+		ids = append(ids, s.ID)
+	}
+	tankerkoenig, err := RegisterLatest(r, TankerkoenigSubject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(`{"city":"Mosbach","timeStamp":1651831810}`)
+	tests := []struct {
+		name     string
+		registry Registry
+		b        []byte
+		version  int
+		err      string
+	}{
+		{"unframed", nil, payload, LatestVersion(WeatherSubject), ""},
+		{"framed v2", r, Frame(ids[1], payload), 2, ""},
+		{"framed v3", r, Frame(ids[2], payload), 3, ""},
+		{"validated against framed version", r, Frame(ids[0], payload), 0, "doesn't match version 1"},
+		{"unknown ID", r, Frame(42, payload), 0, "schema 42 not found"},
+		{"other subject", r, Frame(tankerkoenig.ID, payload), 0, "expected subject 'weather-value'"},
+		{"no registry", nil, Frame(ids[0], payload), 0, "no schema registry is configured"},
+		{"too short", r, []byte{MagicByte, 0}, 0, "framed payload too short"},
+		{"invalid unframed", nil, []byte(`{"city":"Mosbach"}`), 0, "missing required property 'timeStamp'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, got, err := Resolve(tt.registry, WeatherSubject, tt.b)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s.Version != tt.version || !bytes.Equal(got, payload) {
+				t.Errorf("got version %v and payload %q, want version %v and %q",
+					s.Version, got, tt.version, payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+// Package throttle converts rates given on the command line, e.g. messages per
+// second, to the interval of a time.Ticker.
+package throttle
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Interval returns the interval between two events at r events per second.
+// It returns an error if r isn't a finite positive number or if the
+// interval doesn't fit into a time.Duration of at least one nanosecond,
+// as time.NewTicker panics for non-positive intervals.
+func Interval(r float64) (time.Duration, error) {
+	if math.IsNaN(r) || math.IsInf(r, 0) || r <= 0 {
+		return 0, fmt.Errorf("invalid rate %v, must be a positive number", r)
+	}
+	interval := float64(time.Second) / r
+	if interval < 1 || interval >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid rate %v, must be between %.3g and %.0f per second",
+			r, float64(time.Second)/math.MaxInt64, float64(time.Second))
+	}
+	return time.Duration(interval), nil
+}
@@ -0,0 +1,38 @@
+package throttle
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestInterval(t *testing.T) {
+	tests := []struct {
+		rate float64
+		want time.Duration
+		err  bool
+	}{
+		{1, time.Second, false},
+		{100, 10 * time.Millisecond, false},
+		{0.5, 2 * time.Second, false},
+		{1e9, time.Nanosecond, false},
+		{0.001, 1000 * time.Second, false},
+		{2e9, 0, true},
+		{1e-10, 0, true},
+		{0, 0, true},
+		{-1, 0, true},
+		{math.NaN(), 0, true},
+		{math.Inf(1), 0, true},
+		{math.Inf(-1), 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Interval(tt.rate)
+		if (err != nil) != tt.err {
+			t.Errorf("Interval(%v): got error %v, want error %v", tt.rate, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Interval(%v) = %v, want %v", tt.rate, got, tt.want)
+		}
+	}
+}
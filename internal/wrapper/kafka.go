@@ -1,45 +1,178 @@
 package wrapper
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/dateiexplorer/dhbw-vslab-applications/internal/data"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/health"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/kafkaclient"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/logging"
+	"github.com/dateiexplorer/dhbw-vslab-applications/internal/schema"
 )
 
 type WeatherDataHandler func(*data.WeatherData)
 
-func onMessageReceived(msg *kafka.Message, handler WeatherDataHandler) {
-	var weatherData data.WeatherData
-	if err := json.Unmarshal(msg.Value, &weatherData); err != nil {
-		log.Printf("cannot parse message '%v' in weather data: %v\n",
-			string(msg.Value), err)
+// ConsumerOptions holds the optional settings of a consumer.
+type ConsumerOptions struct {
+	// Monitor receives the health checks of the consumer, see
+	// AddConsumerChecks.
+	Monitor *health.Monitor
+	// MaxIdle is the maximum time without a message before the consumer is
+	// reported unhealthy. Disabled if 0.
+	MaxIdle time.Duration
+	// Registry resolves the schemas of framed payloads.
+	Registry schema.Registry
+	// Kafka holds the security settings and additional properties of the
+	// consumer. May be nil.
+	Kafka *kafkaclient.Config
+}
+
+// MessageLogger returns a logger that contains the topic, partition and
+// offset of the Kafka message msg.
+func MessageLogger(logger *slog.Logger, msg *kafka.Message) *slog.Logger {
+	topic := ""
+	if msg.TopicPartition.Topic != nil {
+		topic = *msg.TopicPartition.Topic
+	}
+	return logger.With(
+		"topic", topic,
+		"partition", msg.TopicPartition.Partition,
+		"offset", msg.TopicPartition.Offset.String())
+}
+
+// ConsumerChecks are the health checks of a consumer, see AddConsumerChecks.
+// The embedded Heartbeat must be notified about each received message.
+type ConsumerChecks struct {
+	*health.Heartbeat
+
+	c      *kafka.Consumer
+	mu     sync.RWMutex
+	closed bool
+}
+
+// AddConsumerChecks adds health checks for the consumer c to the monitor m.
+// The checks report the broker connectivity and the partition assignment as
+// readiness and the time since the last message as liveness, which fails if
+// no message was received within maxIdle. All checks are prefixed with name.
+// The consumer must be closed with ConsumerChecks.Close.
+func AddConsumerChecks(m *health.Monitor, name string, c *kafka.Consumer, maxIdle time.Duration) *ConsumerChecks {
+	cc := &ConsumerChecks{Heartbeat: health.NewHeartbeat(), c: c}
+	m.AddLivenessCheck(fmt.Sprintf("%v-last-message", name), cc.Check(maxIdle))
+	m.AddReadinessCheck(fmt.Sprintf("%v-broker", name), cc.checkBroker)
+	m.AddReadinessCheck(fmt.Sprintf("%v-assignment", name), cc.checkAssignment)
+	return cc
+}
+
+// checkBroker requests the metadata once, which fails if no broker is
+// reachable.
+func (cc *ConsumerChecks) checkBroker() error {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	if cc.closed {
+		return errors.New("consumer closed")
+	}
+	if _, err := cc.c.GetMetadata(nil, false, 1000); err != nil {
+		return fmt.Errorf("broker unreachable: %w", err)
+	}
+	return nil
+}
+
+func (cc *ConsumerChecks) checkAssignment() error {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	if cc.closed {
+		return errors.New("consumer closed")
+	}
+	partitions, err := cc.c.Assignment()
+	if err != nil {
+		return err
+	}
+	if len(partitions) == 0 {
+		return errors.New("no partitions assigned")
+	}
+	return nil
+}
+
+// Close marks the consumer as not ready and closes it. It waits for running
+// checks, so the consumer isn't used after it was closed. Close must be
+// called only once.
+func (cc *ConsumerChecks) Close() error {
+	cc.mu.Lock()
+	cc.closed = true
+	cc.mu.Unlock()
+	return cc.c.Close()
+}
+
+// PayloadFormat returns the format of the value of msg, which is given by
+// its content type header. Messages without the header are JSON.
+func PayloadFormat(msg *kafka.Message) (data.Format, error) {
+	for _, h := range msg.Headers {
+		if strings.EqualFold(h.Key, data.ContentTypeHeader) {
+			return data.FormatOfContentType(string(h.Value))
+		}
+	}
+	return data.FormatJSON, nil
+}
+
+// ContentTypeHeader returns the content type header for values in the
+// format f.
+func ContentTypeHeader(f data.Format) kafka.Header {
+	return kafka.Header{Key: data.ContentTypeHeader, Value: []byte(f.ContentType())}
+}
+
+func onMessageReceived(logger *slog.Logger, msg *kafka.Message, registry schema.Registry, handler WeatherDataHandler) {
+	format, err := PayloadFormat(msg)
+	if err != nil {
+		MessageLogger(logger, msg).Warn("cannot determine payload format", "err", err)
+		return
+	}
+	weatherData, err := format.DecodeWeatherData(registry, msg.Value)
+	if err != nil {
+		MessageLogger(logger, msg).Warn("cannot parse message in weather data",
+			"value", string(msg.Value), "err", err)
 	} else {
+		MessageLogger(logger, msg).Debug("weather data received",
+			"city", weatherData.City)
 		// Use the timestamp from the kafka object, because weather datas
 		// timestamp doesn't produce continous data.
 		timestamp := msg.Timestamp
 		weatherData.TimeStamp = timestamp
-		handler(&weatherData)
+		handler(weatherData)
 	}
 }
 
-func RunKafkaWeatherDataConsumer(broker, topic string, stop <-chan os.Signal, handler WeatherDataHandler) {
-	c, err := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers": broker,
+// RunKafkaWeatherDataConsumer consumes weather data from topic and calls
+// handler for each record until a signal is received on stop.
+func RunKafkaWeatherDataConsumer(broker, topic string, stop <-chan os.Signal,
+	opts ConsumerOptions, handler WeatherDataHandler) {
+	logger := slog.With("broker", broker, "topic", topic)
+
+	c, err := opts.Kafka.NewConsumer(broker, kafka.ConfigMap{
 		// A 'group.id' is neccessary, set it to a default value.
 		"group.id": "test-consumer-group",
 	})
-	defer c.Close()
-
 	if err != nil {
-		log.Fatalf("failed to create consumer: %v\n", err)
+		logging.Fatal("failed to create consumer", "broker", broker, "err", err)
 	}
+	heartbeat, closeConsumer := health.NewHeartbeat(), c.Close
+	if opts.Monitor != nil {
+		checks := AddConsumerChecks(opts.Monitor, "kafka", c, opts.MaxIdle)
+		heartbeat, closeConsumer = checks.Heartbeat, checks.Close
+	}
+	defer closeConsumer()
 
-	err = c.Subscribe(topic, nil)
-	log.Println("Consumer created! Waiting for events...")
+	if err := c.Subscribe(topic, nil); err != nil {
+		logging.Fatal("failed to subscribe topic", "broker", broker,
+			"topic", topic, "err", err)
+	}
+	logger.Info("consumer created, waiting for events")
 
 	run := true
 	for run {
@@ -59,11 +192,12 @@ func RunKafkaWeatherDataConsumer(broker, topic string, stop <-chan os.Signal, ha
 					continue
 				}
 				// The client will automatically try to recover from all errors.
-				fmt.Fprintf(os.Stderr, "Consumer error: %v (%v)\n", err, msg)
+				logger.Error("consumer error", "err", err)
 				continue
 			}
 
-			onMessageReceived(msg, handler)
+			heartbeat.Beat()
+			onMessageReceived(logger, msg, opts.Registry, handler)
 		}
 	}
 }